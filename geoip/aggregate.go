@@ -0,0 +1,244 @@
+package geoip
+
+// aggNode mirrors a node of the tree while aggregating, holding the
+// cost table of its subtree.
+type aggNode struct {
+	n    uint32
+	l, r *aggNode
+
+	// dominant payload and the error when the subtree is collapsed
+	// into a single leaf carrying it
+	dom    uint32
+	domErr uint64
+
+	// best[k] is the minimal error using at most k leaves
+	best []uint64
+}
+
+// pcount is the number of addresses in a subtree mapped to v.
+type pcount struct {
+	v uint32
+	c uint64
+}
+
+// Aggregate coarsens the tree so that it contains at most n leaves,
+// by merging sibling subtrees into their dominant payload or dropping
+// them. The choice minimizes the number of addresses whose Lookup
+// result changes, either to another payload, from a payload to
+// nothing or the opposite. It returns that number. Merged leaves lose
+// their source.
+func (t *TreeOf[T]) Aggregate(n int) uint64 {
+	if n < 0 {
+		n = 0
+	}
+
+	t.init()
+	a, _ := t.aggregate(0, 0, n)
+
+	k := len(a.best) - 1
+	e := a.best[k]
+	if !t.build(a, k) {
+		for _, c := range t.nodes[0].c {
+			if c != 0 {
+				t.drop(c)
+			}
+		}
+		t.nodes[0] = node{}
+	}
+	t.normalize(0)
+	return e
+}
+
+// aggregate builds the cost table for the subtree n at depth. It
+// returns the addresses covered by the subtree grouped by payload.
+func (t *TreeOf[T]) aggregate(i uint32, depth int, limit int) (*aggNode, map[any][]pcount) {
+	size := uint64(1) << uint(32-depth)
+	a := &aggNode{n: i}
+	n := t.nodes[i]
+
+	if n.leaf {
+		a.dom = n.v
+		a.best = []uint64{size}
+		if limit > 0 {
+			a.best = append(a.best, 0)
+		}
+		return a, map[any][]pcount{t.key(t.vals[n.v]): {{n.v, size}}}
+	}
+
+	var lc, rc map[any][]pcount
+	if n.c[0] != 0 {
+		a.l, lc = t.aggregate(n.c[0], depth+1, limit)
+	}
+	if n.c[1] != 0 {
+		a.r, rc = t.aggregate(n.c[1], depth+1, limit)
+	}
+
+	// merge the smaller one into the larger one
+	if len(lc) < len(rc) {
+		lc, rc = rc, lc
+	}
+	if lc == nil {
+		lc = make(map[any][]pcount)
+	}
+	for k, ps := range rc {
+		for _, p := range ps {
+			lc[k] = t.addCount(lc[k], p)
+		}
+	}
+
+	var cover, most uint64
+	for _, ps := range lc {
+		for _, p := range ps {
+			cover += p.c
+			if p.c > most || (p.c == most && p.v < a.dom) {
+				most = p.c
+				a.dom = p.v
+			}
+		}
+	}
+	a.domErr = size - most
+
+	max := a.l.leaves() + a.r.leaves()
+	if max > limit {
+		max = limit
+	}
+	a.best = make([]uint64, max+1)
+	for k := range a.best {
+		e, _ := a.split(k)
+		if k > 0 && a.domErr < e {
+			e = a.domErr
+		}
+		if cover < e {
+			e = cover
+		}
+		a.best[k] = e
+	}
+	return a, lc
+}
+
+// leaves returns the number of leaves worth tracking in the cost
+// table of a.
+func (a *aggNode) leaves() int {
+	if a == nil {
+		return 0
+	}
+	return len(a.best) - 1
+}
+
+// cost returns the minimal error of a using at most k leaves.
+func (a *aggNode) cost(k int) uint64 {
+	if a == nil {
+		return 0
+	}
+	if k >= len(a.best) {
+		k = len(a.best) - 1
+	}
+	return a.best[k]
+}
+
+// split finds the best way to share k leaves between children of a,
+// returns the error and the number of leaves given to the left child.
+// a child never gets more leaves than it can use, so the cost of a
+// pass is bounded by the leaves of the tree times the limit.
+func (a *aggNode) split(k int) (uint64, int) {
+	lo, hi := k-a.r.leaves(), a.l.leaves()
+	if lo < 0 {
+		lo = 0
+	}
+	if hi > k {
+		hi = k
+	}
+	if lo > hi {
+		lo = hi
+	}
+
+	var e uint64
+	var kl int
+	for i := lo; i <= hi; i++ {
+		c := a.l.cost(i) + a.r.cost(k-i)
+		if i == lo || c < e {
+			e = c
+			kl = i
+		}
+	}
+	return e, kl
+}
+
+// build rewrites the subtree of a to use at most k leaves with the
+// minimal error. It returns false if the subtree should be removed.
+func (t *TreeOf[T]) build(a *aggNode, k int) bool {
+	if k >= len(a.best) {
+		k = len(a.best) - 1
+	}
+	e := a.best[k]
+	n := &t.nodes[a.n]
+
+	if n.leaf {
+		return k > 0
+	}
+
+	// keep the original structure whenever possible
+	if s, kl := a.split(k); s == e {
+		if a.l != nil && !t.build(a.l, kl) {
+			t.drop(n.c[0])
+			n.c[0] = 0
+		}
+		if a.r != nil && !t.build(a.r, k-kl) {
+			t.drop(n.c[1])
+			n.c[1] = 0
+		}
+		return n.c[0] != 0 || n.c[1] != 0
+	}
+
+	if k > 0 && a.domErr == e {
+		for _, c := range n.c {
+			if c != 0 {
+				t.drop(c)
+			}
+		}
+		n.leaf = true
+		n.v = a.dom
+		n.c = [2]uint32{}
+		return true
+	}
+
+	return false
+}
+
+// normalize combines sibling leaves with the same payload in the
+// subtree n.
+func (t *TreeOf[T]) normalize(i uint32) {
+	n := &t.nodes[i]
+	if n.leaf {
+		return
+	}
+
+	l, r := n.c[0], n.c[1]
+	if l != 0 {
+		t.normalize(l)
+	}
+	if r != 0 {
+		t.normalize(r)
+	}
+
+	if l != 0 && r != 0 &&
+		t.nodes[l].leaf && t.nodes[r].leaf &&
+		t.equiv(&t.nodes[l], &t.nodes[r]) {
+		n.leaf = true
+		n.v = t.nodes[l].v
+		n.s = t.nodes[l].s
+		n.c = [2]uint32{}
+		t.release(l)
+		t.release(r)
+	}
+}
+
+func (t *TreeOf[T]) addCount(ps []pcount, p pcount) []pcount {
+	for i := range ps {
+		if t.same(ps[i].v, p.v) {
+			ps[i].c += p.c
+			return ps
+		}
+	}
+	return append(ps, p)
+}
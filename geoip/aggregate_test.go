@@ -0,0 +1,143 @@
+package geoip
+
+import (
+	"net"
+	"testing"
+)
+
+type gcase struct {
+	i []input
+	n int
+	o string
+	e uint64
+}
+
+func doAggregateTest(t *testing.T, c gcase) {
+	ta := NewTable()
+	for _, in := range c.i {
+		_, cidr, _ := net.ParseCIDR(in.cidr)
+		ta.Add(NewRecordFromCIDR(cidr, in.payload), in.overwrite)
+	}
+	e := ta.Aggregate(c.n)
+	result := ta.Dump()
+	if result != c.o {
+		t.Errorf("want: [%s]\nget: [%s]", c.o, result)
+	}
+	if e != c.e {
+		t.Errorf("error want: %d, get: %d", c.e, e)
+	}
+}
+
+func TestAggregateNoop(t *testing.T) {
+	doAggregateTest(t,
+		gcase{
+			[]input{
+				{"1.0.0.0/30", "A", false},
+				{"1.0.0.4/30", "B", false},
+			},
+			2,
+			"1.0.0.0/30 (A)\n1.0.0.4/30 (B)",
+			0,
+		},
+	)
+}
+
+func TestAggregateDominant(t *testing.T) {
+	doAggregateTest(t,
+		gcase{
+			[]input{
+				{"1.0.0.0/29", "A", false},
+				{"1.0.0.8/30", "A", false},
+				{"1.0.0.12/31", "B", false},
+				{"1.0.0.14/31", "A", false},
+				{"1.0.0.16/28", "C", false},
+			},
+			2,
+			"1.0.0.0/28 (A)\n1.0.0.16/28 (C)",
+			2,
+		},
+	)
+}
+
+func TestAggregateFillHole(t *testing.T) {
+	doAggregateTest(t,
+		gcase{
+			[]input{
+				{"1.0.0.0/29", "A", false},
+				{"1.0.0.8/30", "A", false},
+				{"1.0.0.12/31", "A", false},
+				{"1.0.0.16/28", "C", false},
+			},
+			2,
+			"1.0.0.0/28 (A)\n1.0.0.16/28 (C)",
+			2,
+		},
+	)
+}
+
+func TestAggregateDrop(t *testing.T) {
+	doAggregateTest(t,
+		gcase{
+			[]input{
+				{"1.0.0.0/24", "A", false},
+				{"2.0.0.0/32", "B", false},
+			},
+			1,
+			"1.0.0.0/24 (A)",
+			1,
+		},
+	)
+}
+
+func TestAggregateWhole(t *testing.T) {
+	ta := NewTable()
+	_, a, _ := net.ParseCIDR("0.0.0.0/1")
+	_, b, _ := net.ParseCIDR("128.0.0.0/2")
+	_, c, _ := net.ParseCIDR("192.0.0.0/2")
+	ta.Add(NewRecordFromCIDR(a, ps("A")), false)
+	ta.Add(NewRecordFromCIDR(b, ps("B")), false)
+	ta.Add(NewRecordFromCIDR(c, ps("A")), false)
+
+	if e := ta.Aggregate(1); e != 1<<30 {
+		t.Errorf("error want: %d, get: %d", uint64(1<<30), e)
+	}
+	if v, ok := ta.Lookup(net.ParseIP("130.0.0.1")); !ok || v != ps("A") {
+		t.Errorf("want: A, get: %v", v)
+	}
+	if exp, out := "0.0.0.0/0 (A)", ta.Dump(); out != exp {
+		t.Errorf("want: [%s]\nget: [%s]", exp, out)
+	}
+}
+
+func TestAddWhole(t *testing.T) {
+	_, all, _ := net.ParseCIDR("0.0.0.0/0")
+	_, b, _ := net.ParseCIDR("1.0.0.0/8")
+	lookup := func(ta *Tree, ip string) Payload {
+		v, _ := ta.Lookup(net.ParseIP(ip))
+		return v
+	}
+
+	ta := NewTable()
+	ta.Add(NewRecordFromCIDR(all, ps("A")), false)
+	if exp, out := "0.0.0.0/0 (A)", ta.Dump(); out != exp {
+		t.Errorf("want: [%s]\nget: [%s]", exp, out)
+	}
+	ta.Add(NewRecordFromCIDR(all, ps("B")), false)
+	if v := lookup(ta, "8.8.8.8"); v != ps("A") {
+		t.Errorf("want: A, get: %v", v)
+	}
+
+	// gaps are filled
+	ta = NewTable()
+	ta.Add(NewRecordFromCIDR(b, ps("B")), false)
+	ta.Add(NewRecordFromCIDR(all, ps("A")), false)
+	if v1, v2 := lookup(ta, "1.0.0.1"), lookup(ta, "8.8.8.8"); v1 != ps("B") || v2 != ps("A") {
+		t.Errorf("want: B, A, get: %v, %v", v1, v2)
+	}
+
+	// everything replaced
+	ta.Add(NewRecordFromCIDR(all, ps("C")), true)
+	if exp, out := "0.0.0.0/0 (C)", ta.Dump(); out != exp {
+		t.Errorf("want: [%s]\nget: [%s]", exp, out)
+	}
+}
@@ -0,0 +1,82 @@
+package geoip
+
+import "net"
+
+// Anonymize truncates ip to the largest prefix around it in which all
+// the addresses have the same value as ip, so the prefix can be
+// stored instead of the address without losing its value. The prefix
+// is no more specific than /max. It returns true if the whole prefix
+// maps to the value of ip, false if ip is not covered or the /max
+// prefix holds other values as well. It returns nil if ip is not an
+// IPv4 address.
+func (t *TreeOf[T]) Anonymize(ip net.IP, max int) (*net.IPNet, bool) {
+	if ip == nil || ip.To4() == nil {
+		return nil, false
+	}
+	if max < 0 {
+		max = 0
+	} else if max > 32 {
+		max = 32
+	}
+
+	addr := ipToNum(ip)
+	prefix := func(size int) *net.IPNet {
+		return &net.IPNet{
+			IP:   numToIP(addr & sizeToMask(size)),
+			Mask: net.CIDRMask(size, 32),
+		}
+	}
+
+	leaf, depth := t.find(addr)
+	if leaf == nil {
+		return prefix(max), false
+	}
+
+	// nodes on the path to the leaf by depth
+	path := make([]uint32, 0, depth)
+	n := uint32(0)
+	for d := 0; d < depth; d++ {
+		path = append(path, n)
+		n = t.nodes[n].c[(addr>>uint(31-d))&1]
+	}
+
+	// extend the prefix while the other half has the same value
+	v := t.vals[leaf.v]
+	size := depth
+	for d := depth - 1; d >= 0; d-- {
+		o := t.nodes[path[d]].c[1-(addr>>uint(31-d))&1]
+		if o == 0 || !t.covered(o, v) {
+			break
+		}
+		size = d
+	}
+
+	if size > max {
+		return prefix(max), false
+	}
+	return prefix(size), true
+}
+
+// covered reports whether the subtree n is fully covered by leaves
+// with the value v.
+func (t *TreeOf[T]) covered(n uint32, v T) bool {
+	nd := &t.nodes[n]
+	if nd.leaf {
+		return t.equal(t.vals[nd.v], v)
+	}
+	for _, c := range nd.c {
+		if c == 0 || !t.covered(c, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Anonymize truncates ip to the largest prefix around it with the
+// same payload, see TreeOf.Anonymize.
+func (t *Tree) Anonymize(ip net.IP, max int) (*net.IPNet, bool) {
+	if t == nil {
+		return (*TreeOf[Payload])(nil).Anonymize(ip, max)
+	}
+	return t.t.Anonymize(ip, max)
+}
@@ -0,0 +1,44 @@
+package geoip
+
+import (
+	"net"
+	"testing"
+)
+
+func TestAnonymize(t *testing.T) {
+	ta := NewTable()
+	ta.AddFrom(rec("10.0.0.0/9", "A"), &Source{Name: "a"})
+	ta.AddFrom(rec("10.128.0.0/9", "A"), &Source{Name: "b"})
+	ta.Add(rec("1.0.0.0/24", "A"), false)
+	ta.Add(rec("1.0.0.16/28", "B"), true)
+
+	cases := []struct {
+		ip     string
+		max    int
+		prefix string
+		ok     bool
+	}{
+		{"10.1.2.3", 24, "10.0.0.0/8", true},
+		{"10.1.2.3", 4, "0.0.0.0/4", false},
+		{"1.0.0.200", 32, "1.0.0.128/25", true},
+		{"1.0.0.200", 24, "1.0.0.0/24", false},
+		{"1.0.0.17", 32, "1.0.0.16/28", true},
+		{"1.0.0.1", 40, "1.0.0.0/28", true},
+		{"8.8.8.8", 24, "8.8.8.0/24", false},
+	}
+
+	for _, c := range cases {
+		p, ok := ta.Anonymize(net.ParseIP(c.ip), c.max)
+		if p.String() != c.prefix || ok != c.ok {
+			t.Errorf("ip:[%s/%d], want:[%s %v], get:[%s %v]", c.ip, c.max, c.prefix, c.ok, p, ok)
+		}
+	}
+
+	if p, _ := ta.Anonymize(net.ParseIP("2001:db8::1"), 24); p != nil {
+		t.Errorf("want: nil, get:[%s]", p)
+	}
+	var nt *Tree
+	if p, ok := nt.Anonymize(net.ParseIP("1.2.3.4"), 24); p.String() != "1.2.3.0/24" || ok {
+		t.Errorf("want:[1.2.3.0/24 false], get:[%s %v]", p, ok)
+	}
+}
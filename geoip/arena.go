@@ -0,0 +1,99 @@
+package geoip
+
+import "fmt"
+
+// node is an element of the tree. Nodes live in the node slice of
+// the tree and refer to each other by index, root is always at index
+// 0 so 0 is also used as a nil child. Values and sources are
+// interned in tables of the tree and referred by index as well.
+type node struct {
+	p    uint32
+	c    [2]uint32 // left and right child
+	v    uint32
+	s    uint16
+	leaf bool
+}
+
+// init creates the root node of a zero value tree.
+func (t *TreeOf[T]) init() {
+	if len(t.nodes) == 0 {
+		t.nodes = append(t.nodes, node{})
+	}
+}
+
+// alloc stores n in the tree, reusing released slots if any. Any
+// pointer into the node slice is invalid after calling alloc.
+func (t *TreeOf[T]) alloc(n node) uint32 {
+	if l := len(t.free); l > 0 {
+		i := t.free[l-1]
+		t.free = t.free[:l-1]
+		t.nodes[i] = n
+		return i
+	}
+
+	t.nodes = append(t.nodes, n)
+	return uint32(len(t.nodes) - 1)
+}
+
+// release returns node i to the allocator.
+func (t *TreeOf[T]) release(i uint32) {
+	t.nodes[i] = node{}
+	t.free = append(t.free, i)
+}
+
+// drop releases node i with all its descendants.
+func (t *TreeOf[T]) drop(i uint32) {
+	for _, c := range t.nodes[i].c {
+		if c != 0 {
+			t.drop(c)
+		}
+	}
+	t.release(i)
+}
+
+// intern returns the index of v in the value table, adding it if no
+// equal value is stored yet.
+func (t *TreeOf[T]) intern(v T) uint32 {
+	if t.index == nil {
+		t.index = make(map[any][]uint32)
+	}
+
+	k := t.key(v)
+	for _, i := range t.index[k] {
+		if t.equal(t.vals[i], v) {
+			return i
+		}
+	}
+
+	i := uint32(len(t.vals))
+	t.vals = append(t.vals, v)
+	t.index[k] = append(t.index[k], i)
+	return i
+}
+
+// key groups values which are probably equal for interning.
+func (t *TreeOf[T]) key(v T) any {
+	if t.hash != nil {
+		return t.hash(v)
+	}
+
+	switch p := any(v).(type) {
+	case nil:
+		return nil
+	case Payload:
+		return p.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// same compares two interned values.
+func (t *TreeOf[T]) same(a, b uint32) bool {
+	return a == b || t.equal(t.vals[a], t.vals[b])
+}
+
+// equiv reports whether two leaves can be combined, they must have
+// the same value and source.
+func (t *TreeOf[T]) equiv(a, b *node) bool {
+	return a.s == b.s && t.same(a.v, b.v)
+}
@@ -0,0 +1,126 @@
+package geoip
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrCorrupt = errors.New("corrupted tree")
+
+// Clone returns a deep copy of the tree, it shares nothing with t
+// but the values and sources themselves.
+func (t *TreeOf[T]) Clone() *TreeOf[T] {
+	c := &TreeOf[T]{
+		nodes: append([]node(nil), t.nodes...),
+		free:  append([]uint32(nil), t.free...),
+		vals:  append([]T(nil), t.vals...),
+		srcs:  append([]*Source(nil), t.srcs...),
+		eq:    t.eq,
+		hash:  t.hash,
+	}
+	if t.index != nil {
+		c.index = make(map[any][]uint32, len(t.index))
+		for k, v := range t.index {
+			c.index[k] = append([]uint32(nil), v...)
+		}
+	}
+	if t.sidx != nil {
+		c.sidx = make(map[*Source]uint16, len(t.sidx))
+		for k, v := range t.sidx {
+			c.sidx[k] = v
+		}
+	}
+	return c
+}
+
+// Equal reports whether both trees map every address to equal
+// values, compared by the equality of t. How addresses are split into
+// records and their sources are not compared.
+func (t *TreeOf[T]) Equal(o *TreeOf[T]) bool {
+	c := CompareOf(t, o)
+	return c.Agree == c.Total
+}
+
+// Validate checks the structure of the tree: parent links, leaves
+// without children, no sibling leaves left uncompressed, no empty
+// inner nodes, and references to values, sources and nodes in range.
+// It returns an error wrapping ErrCorrupt on the first violation.
+func (t *TreeOf[T]) Validate() error {
+	if len(t.nodes) == 0 {
+		return nil
+	}
+	if t.nodes[0].p != 0 {
+		return fmt.Errorf("root has parent %d: %w", t.nodes[0].p, ErrCorrupt)
+	}
+
+	var count int
+	var f func(i uint32, depth int) error
+	f = func(i uint32, depth int) error {
+		count++
+		n := &t.nodes[i]
+		if n.leaf {
+			if n.c != [2]uint32{} {
+				return fmt.Errorf("leaf %d has children: %w", i, ErrCorrupt)
+			}
+			if int(n.v) >= len(t.vals) {
+				return fmt.Errorf("leaf %d refers value %d: %w", i, n.v, ErrCorrupt)
+			}
+			if n.s != 0 && int(n.s) >= len(t.srcs) {
+				return fmt.Errorf("leaf %d refers source %d: %w", i, n.s, ErrCorrupt)
+			}
+			return nil
+		}
+
+		if depth == 32 {
+			return fmt.Errorf("node %d below host depth: %w", i, ErrCorrupt)
+		}
+		l, r := n.c[0], n.c[1]
+		if l == 0 && r == 0 && i != 0 {
+			return fmt.Errorf("inner node %d has no child: %w", i, ErrCorrupt)
+		}
+		if l != 0 && r != 0 && t.nodes[l].leaf && t.nodes[r].leaf &&
+			t.equiv(&t.nodes[l], &t.nodes[r]) {
+			return fmt.Errorf("children of node %d not compressed: %w", i, ErrCorrupt)
+		}
+
+		for _, c := range n.c {
+			if c == 0 {
+				continue
+			}
+			if int(c) >= len(t.nodes) {
+				return fmt.Errorf("node %d refers node %d: %w", i, c, ErrCorrupt)
+			}
+			if p := t.nodes[c].p; p != i {
+				return fmt.Errorf("node %d has parent %d, want %d: %w", c, p, i, ErrCorrupt)
+			}
+			if err := f(c, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := f(0, 0); err != nil {
+		return err
+	}
+	if n := len(t.nodes) - len(t.free); count != n {
+		return fmt.Errorf("%d nodes reachable, %d in use: %w", count, n, ErrCorrupt)
+	}
+	return nil
+}
+
+// Clone returns a deep copy of the tree.
+func (t *Tree) Clone() *Tree {
+	return &Tree{t: *t.t.Clone()}
+}
+
+// Equal reports whether both trees map every address to equal
+// payloads, see TreeOf.Equal.
+func (t *Tree) Equal(o *Tree) bool {
+	return t.t.Equal(&o.t)
+}
+
+// Validate checks the structure of the tree, see TreeOf.Validate.
+func (t *Tree) Validate() error {
+	return t.t.Validate()
+}
@@ -0,0 +1,123 @@
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// randomTree builds a tree with random operations, validating it
+// after each of them.
+func randomTree(t *testing.T, seed int64, ops int) *Tree {
+	rnd := rand.New(rand.NewSource(seed))
+	srcs := []*Source{nil, {Name: "a", Priority: 1}, {Name: "b", Priority: 2}}
+
+	ta := NewTable()
+	for i := 0; i < ops; i++ {
+		size := 8 + rnd.Intn(17)
+		c := cidr{prefix: rnd.Uint32() & 0x0f0f0000 & sizeToMask(size), size: size}
+		r := &Record{i: c, v: ps(fmt.Sprint(rnd.Intn(3)))}
+
+		switch op := rnd.Intn(10); {
+		case op < 4:
+			ta.Add(r, rnd.Intn(2) == 0)
+		case op < 7:
+			ta.AddFrom(r, srcs[rnd.Intn(len(srcs))])
+		case op < 8:
+			ta.DeleteRecord(r)
+		case op < 9:
+			ta.Delete(r.Prefix())
+		default:
+			ta.Aggregate(ta.Len() * 3 / 4)
+		}
+
+		if err := ta.Validate(); err != nil {
+			t.Fatalf("seed %d op %d: %v\n%s", seed, i, err, ta.Dump())
+		}
+	}
+	return ta
+}
+
+func TestValidate(t *testing.T) {
+	for seed := int64(1); seed <= 100; seed++ {
+		randomTree(t, seed, 200)
+	}
+	if err := NewTable().Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidateCorrupt(t *testing.T) {
+	cases := map[string]func(tr *TreeOf[Payload]){
+		"parent": func(tr *TreeOf[Payload]) {
+			tr.nodes[tr.nodes[0].c[0]].p = 42
+		},
+		"leaf with children": func(tr *TreeOf[Payload]) {
+			n := &tr.nodes[tr.nodes[0].c[0]]
+			n.leaf = true
+		},
+		"uncompressed": func(tr *TreeOf[Payload]) {
+			n := tr.nodes[0].c[0]
+			tr.nodes[n] = node{p: 0}
+			l := tr.alloc(node{p: n, v: 0, leaf: true})
+			r := tr.alloc(node{p: n, v: 0, leaf: true})
+			tr.nodes[n].c = [2]uint32{l, r}
+		},
+		"leak": func(tr *TreeOf[Payload]) {
+			tr.alloc(node{})
+		},
+	}
+
+	for name, corrupt := range cases {
+		ta := NewTable()
+		ta.Add(rec("1.0.0.0/24", "A"), false)
+		ta.Add(rec("1.0.1.0/24", "B"), false)
+		if err := ta.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		corrupt(&ta.t)
+		if err := ta.Validate(); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: want:[%v], get:[%v]", name, ErrCorrupt, err)
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	ta := randomTree(t, 42, 100)
+	c := ta.Clone()
+	if !c.Equal(ta) || c.Dump() != ta.Dump() {
+		t.Fatalf("want: [%s]\nget: [%s]", ta.Dump(), c.Dump())
+	}
+
+	dump := ta.Dump()
+	c.Add(rec("15.0.0.0/8", "X"), true)
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if ta.Dump() != dump {
+		t.Errorf("original changed by clone")
+	}
+	if c.Equal(ta) || ta.Equal(c) {
+		t.Errorf("want: not equal")
+	}
+}
+
+func TestEqualCoverage(t *testing.T) {
+	a := &Source{Name: "a", Priority: 1}
+	b := &Source{Name: "b", Priority: 1}
+
+	ta := NewTable()
+	ta.AddFrom(rec("1.0.0.0/25", "A"), a)
+	ta.AddFrom(rec("1.0.0.128/25", "A"), b)
+	tb := NewTable()
+	tb.Add(rec("1.0.0.0/24", "A"), false)
+	if !ta.Equal(tb) || !tb.Equal(ta) {
+		t.Errorf("want equal: [%s] [%s]", ta.Dump(), tb.Dump())
+	}
+
+	tb.Add(rec("2.0.0.0/32", "A"), false)
+	if ta.Equal(tb) || tb.Equal(ta) {
+		t.Errorf("want not equal: [%s] [%s]", ta.Dump(), tb.Dump())
+	}
+}
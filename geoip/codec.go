@@ -0,0 +1,352 @@
+package geoip
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var (
+	ErrNoMarshal   = errors.New("payload does not implement Marshaler")
+	ErrUnknownType = errors.New("unknown payload type")
+	ErrFormat      = errors.New("invalid data format")
+)
+
+// Marshaler is implemented by payloads which can be persisted. Tag
+// names the payload type and must be registered with Register
+// before loading.
+type Marshaler interface {
+	Payload
+	Tag() string
+	MarshalBinary() ([]byte, error)
+	MarshalJSON() ([]byte, error)
+}
+
+// Decoder converts the marshaled forms back into payloads.
+type Decoder struct {
+	Binary func(data []byte) (Payload, error)
+	JSON   func(data []byte) (Payload, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Decoder)
+)
+
+// Register makes a payload type available for loading by its tag. It
+// panics if the tag is empty or registered twice.
+func Register(tag string, d Decoder) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if tag == "" {
+		panic("geoip: register payload with empty tag")
+	}
+	if _, dup := registry[tag]; dup {
+		panic("geoip: register payload twice for tag " + tag)
+	}
+	registry[tag] = d
+}
+
+func decoder(tag string) (Decoder, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	d, ok := registry[tag]
+	if !ok {
+		return d, fmt.Errorf("%q: %w", tag, ErrUnknownType)
+	}
+	return d, nil
+}
+
+// DecodeBinary converts data of the type tag into a payload.
+func DecodeBinary(tag string, data []byte) (Payload, error) {
+	d, err := decoder(tag)
+	if err != nil {
+		return nil, err
+	}
+	if d.Binary == nil {
+		return nil, fmt.Errorf("%q: no binary decoder: %w", tag, ErrUnknownType)
+	}
+	return d.Binary(data)
+}
+
+// DecodeJSON converts data of the type tag into a payload.
+func DecodeJSON(tag string, data []byte) (Payload, error) {
+	d, err := decoder(tag)
+	if err != nil {
+		return nil, err
+	}
+	if d.JSON == nil {
+		return nil, fmt.Errorf("%q: no json decoder: %w", tag, ErrUnknownType)
+	}
+	return d.JSON(data)
+}
+
+func marshaler(v Payload) (Marshaler, error) {
+	m, ok := v.(Marshaler)
+	if !ok {
+		return nil, fmt.Errorf("%T: %w", v, ErrNoMarshal)
+	}
+	return m, nil
+}
+
+const binaryMagic = "GEOIPT\x00\x01"
+
+// Save writes the tree in a compact binary format, including the
+// name and priority of sources. All non-nil payloads must implement
+// Marshaler.
+func (t *Tree) Save(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(binaryMagic); err != nil {
+		return err
+	}
+
+	var err error
+	var buf []byte
+	t.walk(func(r *Record, ud interface{}) {
+		if err != nil {
+			return
+		}
+		if buf, err = appendRecord(buf[:0], r); err == nil {
+			_, err = bw.Write(buf)
+		}
+	}, nil)
+
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// appendRecord appends the binary form of r to b: the prefix, the
+// size, the tag and data of the payload prefixed by their length, and
+// the source.
+func appendRecord(b []byte, r *Record) ([]byte, error) {
+	var tag string
+	var data []byte
+	if r.v != nil {
+		m, err := marshaler(r.v)
+		if err != nil {
+			return nil, err
+		}
+		tag = m.Tag()
+		if data, err = m.MarshalBinary(); err != nil {
+			return nil, err
+		}
+	}
+
+	b = binary.BigEndian.AppendUint32(b, r.i.prefix)
+	b = append(b, byte(r.i.size))
+	b = binary.AppendUvarint(b, uint64(len(tag)))
+	b = append(b, tag...)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	b = append(b, data...)
+	return appendSource(b, r.s), nil
+}
+
+// appendSource appends a flag telling whether src is known, followed
+// by its name prefixed by the length and its priority.
+func appendSource(b []byte, src *Source) []byte {
+	if src == nil {
+		return append(b, 0)
+	}
+	b = append(b, 1)
+	b = binary.AppendUvarint(b, uint64(len(src.Name)))
+	b = append(b, src.Name...)
+	return binary.AppendVarint(b, int64(src.Priority))
+}
+
+// sources collects the sources read back, so records of the same
+// source share it.
+type sources map[Source]*Source
+
+func (ss sources) get(name string, priority int) *Source {
+	k := Source{Name: name, Priority: priority}
+	src, ok := ss[k]
+	if !ok {
+		src = &k
+		ss[k] = src
+	}
+	return src
+}
+
+// byteReader is the input of readRecord.
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// readRecord reads a record written by appendRecord, it returns
+// io.EOF if there is nothing left. Sources are shared through ss.
+func readRecord(br byteReader, ss sources) (*Record, error) {
+	get := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if n > 1<<24 {
+			return nil, ErrFormat
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(br, b)
+		return b, err
+	}
+
+	fix := make([]byte, 5)
+	if _, err := io.ReadFull(br, fix); err == io.EOF {
+		return nil, err
+	} else if err != nil {
+		return nil, ErrFormat
+	}
+
+	c := cidr{
+		prefix: binary.BigEndian.Uint32(fix),
+		size:   int(fix[4]),
+	}
+	if c.size > 32 || c.prefix&^sizeToMask(c.size) != 0 {
+		return nil, fmt.Errorf("%s: %w", &c, ErrFormat)
+	}
+
+	tag, err := get()
+	if err != nil {
+		return nil, ErrFormat
+	}
+	data, err := get()
+	if err != nil {
+		return nil, ErrFormat
+	}
+
+	known, err := br.ReadByte()
+	if err != nil || known > 1 {
+		return nil, ErrFormat
+	}
+	var src *Source
+	if known == 1 {
+		name, err := get()
+		if err != nil {
+			return nil, ErrFormat
+		}
+		prio, err := binary.ReadVarint(br)
+		if err != nil {
+			return nil, ErrFormat
+		}
+		src = ss.get(string(name), int(prio))
+	}
+
+	var v Payload
+	if len(tag) != 0 {
+		if v, err = DecodeBinary(string(tag), data); err != nil {
+			return nil, err
+		}
+	}
+	return &Record{i: c, v: v, s: src}, nil
+}
+
+// LoadBinary reads a tree written by Save, payloads are converted
+// back by the registered decoders. Sources are restored with their
+// name and priority.
+func LoadBinary(r io.Reader) (*Tree, error) {
+	br := bufio.NewReader(r)
+	head := make([]byte, len(binaryMagic))
+	if _, err := io.ReadFull(br, head); err != nil || string(head) != binaryMagic {
+		return nil, ErrFormat
+	}
+
+	t := NewTable()
+	ss := make(sources)
+	for {
+		rec, err := readRecord(br, ss)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		t.AddFrom(rec, rec.s)
+	}
+	return t, nil
+}
+
+// jsonRecord is the JSON form of a record.
+type jsonRecord struct {
+	Prefix  string          `json:"prefix"`
+	Type    string          `json:"type,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Source  *jsonSource     `json:"source,omitempty"`
+}
+
+// jsonSource is the JSON form of a source.
+type jsonSource struct {
+	Name     string `json:"name"`
+	Priority int    `json:"priority,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler, the tree is encoded as an
+// array of records with their sources. All non-nil payloads must
+// implement Marshaler.
+func (t *Tree) MarshalJSON() ([]byte, error) {
+	var err error
+	rs := []jsonRecord{}
+
+	t.walk(func(r *Record, ud interface{}) {
+		if err != nil {
+			return
+		}
+
+		jr := jsonRecord{Prefix: r.i.String()}
+		if r.s != nil {
+			jr.Source = &jsonSource{Name: r.s.Name, Priority: r.s.Priority}
+		}
+		if r.v != nil {
+			var m Marshaler
+			if m, err = marshaler(r.v); err != nil {
+				return
+			}
+			jr.Type = m.Tag()
+			if jr.Payload, err = m.MarshalJSON(); err != nil {
+				return
+			}
+		}
+		rs = append(rs, jr)
+	}, nil)
+
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(rs)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, payloads are converted
+// back by the registered decoders. Records are added into t with
+// their sources, see AddFrom.
+func (t *Tree) UnmarshalJSON(data []byte) error {
+	var rs []jsonRecord
+	if err := json.Unmarshal(data, &rs); err != nil {
+		return err
+	}
+
+	ss := make(sources)
+	for _, jr := range rs {
+		var v Payload
+		if jr.Type != "" {
+			var err error
+			if v, err = DecodeJSON(jr.Type, jr.Payload); err != nil {
+				return err
+			}
+		}
+		r, err := ParseCIDR(jr.Prefix, v)
+		if err != nil {
+			return err
+		}
+		var src *Source
+		if jr.Source != nil {
+			src = t.t.known(ss.get(jr.Source.Name, jr.Source.Priority))
+		}
+		t.AddFrom(r, src)
+	}
+	return nil
+}
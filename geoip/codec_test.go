@@ -0,0 +1,216 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+)
+
+func (p ps) Tag() string {
+	return "ps"
+}
+
+func (p ps) MarshalBinary() ([]byte, error) {
+	return []byte(p), nil
+}
+
+func (p ps) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(p))
+}
+
+func init() {
+	Register("ps", Decoder{
+		Binary: func(data []byte) (Payload, error) {
+			return ps(data), nil
+		},
+		JSON: func(data []byte) (Payload, error) {
+			var s string
+			err := json.Unmarshal(data, &s)
+			return ps(s), err
+		},
+	})
+}
+
+type pn int
+
+func (p pn) Equal(t Payload) bool {
+	return p == t
+}
+
+func (p pn) String() string {
+	return "n"
+}
+
+func rec(s string, v ps) *Record {
+	_, cidr, _ := net.ParseCIDR(s)
+	return NewRecordFromCIDR(cidr, v)
+}
+
+func sampleTree() *Tree {
+	ta := NewTable()
+	for _, in := range []input{
+		{"1.0.0.4/30", "A", false},
+		{"1.0.0.8/30", "A", false},
+		{"1.0.0.5/32", "B", true},
+		{"10.0.0.0/8", "C\n\"", false},
+		{"0.0.0.0/32", "", false},
+	} {
+		_, cidr, _ := net.ParseCIDR(in.cidr)
+		ta.Add(NewRecordFromCIDR(cidr, in.payload), in.overwrite)
+	}
+	_, cidr, _ := net.ParseCIDR("20.0.0.0/8")
+	ta.Add(NewRecordFromCIDR(cidr, nil), false)
+	return ta
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	ta := sampleTree()
+	var buf bytes.Buffer
+	if err := ta.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lt, err := LoadBinary(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, out := ta.Dump(), lt.Dump(); want != out {
+		t.Errorf("want: [%s]\nget: [%s]", want, out)
+	}
+
+	if _, err := LoadBinary(bytes.NewReader([]byte("garbage!"))); !errors.Is(err, ErrFormat) {
+		t.Errorf("want:[%v], get:[%v]", ErrFormat, err)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	ta := sampleTree()
+	data, err := json.Marshal(ta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lt := NewTable()
+	if err := json.Unmarshal(data, lt); err != nil {
+		t.Fatal(err)
+	}
+	if want, out := ta.Dump(), lt.Dump(); want != out {
+		t.Errorf("want: [%s]\nget: [%s]", want, out)
+	}
+
+	bad := []byte(`[{"prefix":"1.0.0.0/8","type":"none","payload":1}]`)
+	if err := json.Unmarshal(bad, lt); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("want:[%v], get:[%v]", ErrUnknownType, err)
+	}
+}
+
+func TestAggregatedRoundTrip(t *testing.T) {
+	ta := NewTable()
+	for _, in := range []input{
+		{"0.0.0.0/1", "A", false},
+		{"128.0.0.0/2", "B", false},
+		{"192.0.0.0/2", "A", false},
+	} {
+		_, cidr, _ := net.ParseCIDR(in.cidr)
+		ta.Add(NewRecordFromCIDR(cidr, in.payload), in.overwrite)
+	}
+	ta.Aggregate(1)
+	want := ta.Dump()
+	if want != "0.0.0.0/0 (A)" {
+		t.Fatalf("get: [%s]", want)
+	}
+
+	var buf bytes.Buffer
+	if err := ta.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lt, err := LoadBinary(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := lt.Dump(); out != want {
+		t.Errorf("binary: want: [%s]\nget: [%s]", want, out)
+	}
+
+	data, err := json.Marshal(ta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lt = NewTable()
+	if err := json.Unmarshal(data, lt); err != nil {
+		t.Fatal(err)
+	}
+	if out := lt.Dump(); out != want {
+		t.Errorf("json: want: [%s]\nget: [%s]", want, out)
+	}
+}
+
+func TestSaveNoMarshal(t *testing.T) {
+	ta := NewTable()
+	_, cidr, _ := net.ParseCIDR("1.0.0.0/8")
+	ta.Add(NewRecordFromCIDR(cidr, pn(1)), false)
+	if err := ta.Save(&bytes.Buffer{}); !errors.Is(err, ErrNoMarshal) {
+		t.Errorf("want:[%v], get:[%v]", ErrNoMarshal, err)
+	}
+	if _, err := json.Marshal(ta); !errors.Is(err, ErrNoMarshal) {
+		t.Errorf("want:[%v], get:[%v]", ErrNoMarshal, err)
+	}
+}
+
+func TestSourceRoundTrip(t *testing.T) {
+	ta := NewTable()
+	a := &Source{Name: "a", Priority: 2}
+	b := &Source{Name: "b", Priority: -1}
+	ta.AddFrom(rec("1.0.0.0/24", "A"), a)
+	ta.AddFrom(rec("1.0.1.0/24", "A"), a)
+	ta.AddFrom(rec("2.0.0.0/8", "B"), b)
+	ta.Add(rec("3.0.0.0/8", "C"), false)
+	want := ta.Dump()
+
+	check := func(name string, lt *Tree) {
+		t.Helper()
+		if out := lt.Dump(); out != want {
+			t.Errorf("%s: want: [%s]\nget: [%s]", name, want, out)
+		}
+		for ip, src := range map[string]*Source{"1.0.1.1": a, "2.0.0.1": b, "3.0.0.1": nil} {
+			r, _ := lt.LookupRecord(net.ParseIP(ip))
+			got := r.Source()
+			if (got == nil) != (src == nil) || got != nil && *got != *src {
+				t.Errorf("%s: %s: want: %v, get: %v", name, ip, src, got)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := ta.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lt, err := LoadBinary(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("binary", lt)
+
+	data, err := json.Marshal(ta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lt = NewTable()
+	if err := json.Unmarshal(data, lt); err != nil {
+		t.Fatal(err)
+	}
+	check("json", lt)
+
+	// replayed changes share the sources of the snapshot
+	var log bytes.Buffer
+	j := NewJournal(&log)
+	r := rec("1.0.2.0/23", "A")
+	r.s = &Source{Name: "a", Priority: 2}
+	j.Add(r)
+	if _, err := lt.Replay(&log); err != nil {
+		t.Fatal(err)
+	}
+	if s := lt.Stats(); s.Sources != 2 || s.Records != 3 {
+		t.Errorf("want: 2 sources, 3 records, get: %+v", s)
+	}
+}
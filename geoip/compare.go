@@ -0,0 +1,206 @@
+package geoip
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+)
+
+// AgreementOf counts the addresses with the same value in the first
+// tree of a comparison.
+type AgreementOf[T any] struct {
+	Value T
+	Total uint64 // addresses with Value in the first tree
+	Agree uint64 // of them, addresses with an equal value in the second
+}
+
+// ComparisonOf is the result of comparing two trees, in number of
+// addresses or number of sampled IPs.
+type ComparisonOf[T any] struct {
+	Total uint64 // covered by any of the trees
+	Agree uint64 // covered by both with equal values
+	OnlyA uint64 // covered by the first tree only
+	OnlyB uint64 // covered by the second tree only
+
+	// breakdown by value of the first tree, most common first
+	Values []AgreementOf[T]
+}
+
+// Comparison is a ComparisonOf trees of Payload.
+type Comparison = ComparisonOf[Payload]
+
+// Ratio returns the fraction of agreement, 1 if nothing is covered.
+func (c *ComparisonOf[T]) Ratio() float64 {
+	if c.Total == 0 {
+		return 1
+	}
+	return float64(c.Agree) / float64(c.Total)
+}
+
+// comparer accumulates a comparison, values of the first tree are
+// grouped by index.
+type comparer[T any] struct {
+	a, b *TreeOf[T]
+	c    ComparisonOf[T]
+	idx  map[uint32]int
+}
+
+func newComparer[T any](a, b *TreeOf[T]) *comparer[T] {
+	return &comparer[T]{a: a, b: b, idx: make(map[uint32]int)}
+}
+
+// count accounts n addresses where the trees have leaves la and lb,
+// nil if not covered.
+func (cp *comparer[T]) count(la, lb *node, n uint64) {
+	if la == nil && lb == nil {
+		return
+	}
+
+	c := &cp.c
+	c.Total += n
+	switch {
+	case la == nil:
+		c.OnlyB += n
+		return
+	case lb == nil:
+		c.OnlyA += n
+	}
+
+	i, ok := cp.idx[la.v]
+	if !ok {
+		i = len(c.Values)
+		cp.idx[la.v] = i
+		c.Values = append(c.Values, AgreementOf[T]{Value: cp.a.vals[la.v]})
+	}
+	c.Values[i].Total += n
+
+	if lb != nil && cp.a.equal(cp.a.vals[la.v], cp.b.vals[lb.v]) {
+		c.Values[i].Agree += n
+		c.Agree += n
+	}
+}
+
+// result merges equal values of the first tree and sorts them.
+func (cp *comparer[T]) result() *ComparisonOf[T] {
+	c := &cp.c
+	var vs []AgreementOf[T]
+	groups := make(map[any][]int)
+	for _, v := range c.Values {
+		k := cp.a.key(v.Value)
+		merged := false
+		for _, i := range groups[k] {
+			if cp.a.equal(vs[i].Value, v.Value) {
+				vs[i].Total += v.Total
+				vs[i].Agree += v.Agree
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			groups[k] = append(groups[k], len(vs))
+			vs = append(vs, v)
+		}
+	}
+
+	sort.SliceStable(vs, func(i, j int) bool {
+		return vs[i].Total > vs[j].Total
+	})
+	c.Values = vs
+	return c
+}
+
+// CompareOf computes the agreement of two trees over the whole
+// address space, with an exact walk of both. Values are compared with
+// the equality of a.
+func CompareOf[T any](a, b *TreeOf[T]) *ComparisonOf[T] {
+	cp := newComparer(a, b)
+
+	// na and nb are nodes of each tree at the same position, or the
+	// leaf covering it, or nil
+	var f func(na, nb *node, depth int)
+	f = func(na, nb *node, depth int) {
+		if (na == nil || na.leaf) && (nb == nil || nb.leaf) {
+			cp.count(na, nb, uint64(1)<<uint(32-depth))
+			return
+		}
+
+		for i := 0; i < 2; i++ {
+			f(child(a, na, i), child(b, nb, i), depth+1)
+		}
+	}
+
+	var ra, rb *node
+	if len(a.nodes) != 0 {
+		ra = &a.nodes[0]
+	}
+	if len(b.nodes) != 0 {
+		rb = &b.nodes[0]
+	}
+	f(ra, rb, 0)
+	return cp.result()
+}
+
+// child returns the i-th child of n in t, a leaf covers its children.
+func child[T any](t *TreeOf[T], n *node, i int) *node {
+	if n == nil || n.leaf {
+		return n
+	}
+	if n.c[i] == 0 {
+		return nil
+	}
+	return &t.nodes[n.c[i]]
+}
+
+// CompareSampleOf computes the agreement of two trees on the sample
+// ips, each of them counts as 1.
+func CompareSampleOf[T any](a, b *TreeOf[T], ips []net.IP) *ComparisonOf[T] {
+	cp := newComparer(a, b)
+	for _, ip := range ips {
+		la, _ := a.find(ipToNum(ip))
+		lb, _ := b.find(ipToNum(ip))
+		cp.count(la, lb, 1)
+	}
+	return cp.result()
+}
+
+// Compare computes the agreement of two trees over the whole address
+// space. See CompareOf.
+func Compare(a, b *Tree) *Comparison {
+	return CompareOf(&a.t, &b.t)
+}
+
+// CompareSample computes the agreement of two trees on the sample
+// ips. See CompareSampleOf.
+func CompareSample(a, b *Tree, ips []net.IP) *Comparison {
+	return CompareSampleOf(&a.t, &b.t, ips)
+}
+
+// ReadIPs reads IPv4 addresses from r, one per line, as the sample of
+// CompareSample. Empty lines and lines starting with '#' are ignored.
+func ReadIPs(r io.Reader) ([]net.IP, error) {
+	var ips []net.IP
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		ip := net.ParseIP(line)
+		if ip == nil {
+			return nil, fmt.Errorf("line %d: %w", n, ErrSyntax)
+		}
+		if ip.To4() == nil {
+			return nil, fmt.Errorf("line %d: %w", n, ErrFamily)
+		}
+		ips = append(ips, ip)
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return ips, nil
+}
@@ -0,0 +1,74 @@
+package geoip
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func buildTree(in []input) *Tree {
+	ta := NewTable()
+	for _, i := range in {
+		_, cidr, _ := net.ParseCIDR(i.cidr)
+		ta.Add(NewRecordFromCIDR(cidr, i.payload), i.overwrite)
+	}
+	return ta
+}
+
+func TestCompare(t *testing.T) {
+	a := buildTree([]input{
+		{"1.0.0.0/24", "A", false},
+		{"1.0.1.0/24", "B", false},
+		{"2.0.0.0/24", "C", false},
+	})
+	b := buildTree([]input{
+		{"1.0.0.0/25", "A", false},
+		{"1.0.0.128/25", "X", false},
+		{"1.0.1.0/24", "B", false},
+		{"3.0.0.0/23", "C", false},
+	})
+
+	c := Compare(a, b)
+	if c.Total != 256*5 || c.Agree != 128+256 || c.OnlyA != 256 || c.OnlyB != 512 {
+		t.Errorf("get: %+v", c)
+	}
+	if r := c.Ratio(); r != 0.3 {
+		t.Errorf("want: 0.3, get: %f", r)
+	}
+
+	exp := []AgreementOf[Payload]{
+		{ps("A"), 256, 128},
+		{ps("B"), 256, 256},
+		{ps("C"), 256, 0},
+	}
+	if len(c.Values) != len(exp) {
+		t.Fatalf("get: %+v", c.Values)
+	}
+	for i := range exp {
+		if c.Values[i] != exp[i] {
+			t.Errorf("want: %+v, get: %+v", exp[i], c.Values[i])
+		}
+	}
+
+	if c := Compare(a, a); c.Ratio() != 1 || c.Total != 256*3 {
+		t.Errorf("get: %+v", c)
+	}
+}
+
+func TestCompareSample(t *testing.T) {
+	a := buildTree([]input{{"1.0.0.0/24", "A", false}})
+	b := buildTree([]input{{"1.0.0.0/25", "A", false}})
+
+	ips, err := ReadIPs(strings.NewReader("# sample\n1.0.0.1\n\n1.0.0.200\n1.0.0.2\n9.9.9.9\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := CompareSample(a, b, ips)
+	if c.Total != 3 || c.Agree != 2 || c.OnlyA != 1 || len(c.Values) != 1 {
+		t.Errorf("get: %+v", c)
+	}
+
+	if _, err := ReadIPs(strings.NewReader("1.0.0.1\n::1\n")); err == nil {
+		t.Error("want error")
+	}
+}
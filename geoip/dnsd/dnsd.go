@@ -0,0 +1,327 @@
+// Package dnsd answers geoip lookups over DNS, in the widely used
+// reverse-octet form: a TXT query of 4.3.2.1.origin.example. is
+// answered with the record of 1.2.3.4 if the zone is origin.example.
+//
+// Both UDP and TCP transports are supported. EDNS is not, so UDP
+// answers larger than 512 bytes are truncated and clients are
+// expected to retry over TCP.
+package dnsd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xofyarg/goutil/geoip"
+	"github.com/xofyarg/goutil/log"
+)
+
+const (
+	typeTXT  = 16
+	typeANY  = 255
+	classIN  = 1
+	classANY = 255
+
+	rcodeFormErr  = 1
+	rcodeServFail = 2
+	rcodeNXDomain = 3
+	rcodeNotImp   = 4
+	rcodeRefused  = 5
+
+	headerLen = 12
+	udpMax    = 512
+	tcpMax    = 65535
+)
+
+// how long an idle TCP connection is kept
+var tcpIdle = 10 * time.Second
+
+var errFormat = errors.New("malformed message")
+
+// Server answers TXT queries under a zone from a table.
+type Server struct {
+	// TTL of the answers in seconds.
+	TTL uint32
+	// Format converts a record into the strings of the TXT answer.
+	Format func(r *geoip.Record) []string
+
+	zone []string
+	tree func() *geoip.Tree
+}
+
+// New creates a server answering queries under zone, e.g.
+// "origin.example.", from the table returned by tree.
+func New(zone string, tree func() *geoip.Tree) *Server {
+	return &Server{
+		TTL:    300,
+		Format: Format,
+		zone:   labels(zone),
+		tree:   tree,
+	}
+}
+
+// Format is the default TXT format: "payload | prefix", followed by
+// " | source" if the record has one.
+func Format(r *geoip.Record) []string {
+	v := "-"
+	if p := r.Payload(); p != nil {
+		v = p.String()
+	}
+
+	s := fmt.Sprintf("%s | %s", v, r.Prefix())
+	if src := r.Source(); src != nil {
+		s += " | " + src.Name
+	}
+	return []string{s}
+}
+
+// ServeUDP answers queries received from c until it is closed.
+func (s *Server) ServeUDP(c net.PacketConn) error {
+	buf := make([]byte, tcpMax)
+	for {
+		n, addr, err := c.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		if resp := s.Answer(buf[:n], udpMax); resp != nil {
+			if _, err := c.WriteTo(resp, addr); err != nil {
+				log.Debugf("dnsd: write to %s: %v", addr, err)
+			}
+		}
+	}
+}
+
+// ServeTCP answers queries from connections accepted from l until it
+// is closed.
+func (s *Server) ServeTCP(l net.Listener) error {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(c)
+	}
+}
+
+func (s *Server) serveConn(c net.Conn) {
+	defer c.Close()
+
+	var head [2]byte
+	buf := make([]byte, tcpMax)
+	for {
+		c.SetDeadline(time.Now().Add(tcpIdle))
+		if _, err := io.ReadFull(c, head[:]); err != nil {
+			return
+		}
+		n := binary.BigEndian.Uint16(head[:])
+		if _, err := io.ReadFull(c, buf[:n]); err != nil {
+			return
+		}
+
+		resp := s.Answer(buf[:n], tcpMax)
+		if resp == nil {
+			return
+		}
+		msg := make([]byte, 2, 2+len(resp))
+		binary.BigEndian.PutUint16(msg, uint16(len(resp)))
+		if _, err := c.Write(append(msg, resp...)); err != nil {
+			return
+		}
+	}
+}
+
+// Answer builds the response of a query message, no longer than max
+// bytes. It returns nil if the message should be ignored.
+func (s *Server) Answer(req []byte, max int) []byte {
+	if len(req) < headerLen {
+		return nil
+	}
+	flags := binary.BigEndian.Uint16(req[2:])
+	if flags&0x8000 != 0 {
+		// not a query
+		return nil
+	}
+
+	// QR, opcode, AA and RD
+	rflags := 0x8000 | flags&0x7800 | 0x0400 | flags&0x0100
+	resp := make([]byte, headerLen, udpMax)
+	copy(resp, req[:2])
+
+	reply := func(rcode uint16, question []byte, answer []byte) []byte {
+		binary.BigEndian.PutUint16(resp[2:], rflags|rcode)
+		if question != nil {
+			binary.BigEndian.PutUint16(resp[4:], 1)
+			resp = append(resp, question...)
+		}
+		if answer != nil {
+			if len(resp)+len(answer) > max {
+				// truncated
+				binary.BigEndian.PutUint16(resp[2:], rflags|rcode|0x0200)
+				return resp
+			}
+			binary.BigEndian.PutUint16(resp[6:], 1)
+			resp = append(resp, answer...)
+		}
+		return resp
+	}
+
+	if (flags>>11)&0xf != 0 {
+		return reply(rcodeNotImp, nil, nil)
+	}
+	if binary.BigEndian.Uint16(req[4:]) != 1 {
+		return reply(rcodeFormErr, nil, nil)
+	}
+
+	name, end, err := parseName(req, headerLen)
+	if err != nil || end+4 > len(req) {
+		return reply(rcodeFormErr, nil, nil)
+	}
+	qtype := binary.BigEndian.Uint16(req[end:])
+	qclass := binary.BigEndian.Uint16(req[end+2:])
+	question := req[headerLen : end+4]
+
+	rest, ok := s.inZone(name)
+	if !ok || (qclass != classIN && qclass != classANY) {
+		return reply(rcodeRefused, question, nil)
+	}
+	if len(rest) == 0 {
+		// zone apex
+		return reply(0, question, nil)
+	}
+
+	ip, ok := parseReverse(rest)
+	if !ok {
+		return reply(rcodeNXDomain, question, nil)
+	}
+	if ip == nil {
+		// an empty non-terminal, e.g. 0.10.origin.example. on the way
+		// to the names of addresses
+		return reply(0, question, nil)
+	}
+	t := s.tree()
+	if t == nil {
+		return reply(rcodeServFail, question, nil)
+	}
+	r, ok := t.LookupRecord(ip)
+	if !ok {
+		return reply(rcodeNXDomain, question, nil)
+	}
+	if qtype != typeTXT && qtype != typeANY {
+		return reply(0, question, nil)
+	}
+	return reply(0, question, s.txt(r))
+}
+
+// txt builds the TXT answer of r, its name points to the question.
+func (s *Server) txt(r *geoip.Record) []byte {
+	var rdata []byte
+	for _, str := range s.Format(r) {
+		for {
+			n := len(str)
+			if n > 255 {
+				n = 255
+			}
+			rdata = append(rdata, byte(n))
+			rdata = append(rdata, str[:n]...)
+			str = str[n:]
+			if len(str) == 0 {
+				break
+			}
+		}
+	}
+
+	rr := make([]byte, 12, 12+len(rdata))
+	binary.BigEndian.PutUint16(rr, 0xc000|headerLen)
+	binary.BigEndian.PutUint16(rr[2:], typeTXT)
+	binary.BigEndian.PutUint16(rr[4:], classIN)
+	binary.BigEndian.PutUint32(rr[6:], s.TTL)
+	binary.BigEndian.PutUint16(rr[10:], uint16(len(rdata)))
+	return append(rr, rdata...)
+}
+
+// inZone returns the labels of name before the zone.
+func (s *Server) inZone(name []string) ([]string, bool) {
+	n := len(name) - len(s.zone)
+	if n < 0 {
+		return nil, false
+	}
+	for i, l := range s.zone {
+		if name[n+i] != l {
+			return nil, false
+		}
+	}
+	return name[:n], true
+}
+
+// parseName reads an uncompressed domain name at off of msg, returns
+// the lower case labels and the offset after it.
+func parseName(msg []byte, off int) ([]string, int, error) {
+	var ls []string
+	total := 0
+	for {
+		if off >= len(msg) {
+			return nil, 0, errFormat
+		}
+		n := int(msg[off])
+		off++
+		if n == 0 {
+			return ls, off, nil
+		}
+		// compression is not expected in questions
+		if n&0xc0 != 0 || off+n > len(msg) {
+			return nil, 0, errFormat
+		}
+		total += n + 1
+		if total > 255 {
+			return nil, 0, errFormat
+		}
+		ls = append(ls, strings.ToLower(string(msg[off:off+n])))
+		off += n
+	}
+}
+
+// parseReverse converts reversed octets into an IPv4 address. It
+// returns false if ls are not 1 to 4 octets, and a nil address for
+// less than 4 of them.
+func parseReverse(ls []string) (net.IP, bool) {
+	if len(ls) > 4 {
+		return nil, false
+	}
+
+	ip := make(net.IP, net.IPv4len)
+	for i, l := range ls {
+		if len(l) > 1 && l[0] == '0' {
+			return nil, false
+		}
+		n, err := strconv.ParseUint(l, 10, 8)
+		if err != nil {
+			return nil, false
+		}
+		ip[len(ls)-1-i] = byte(n)
+	}
+	if len(ls) < 4 {
+		return nil, true
+	}
+	return ip, true
+}
+
+// labels splits a domain name into lower case labels.
+func labels(name string) []string {
+	name = strings.Trim(strings.ToLower(name), ".")
+	if name == "" {
+		return nil
+	}
+	return strings.Split(name, ".")
+}
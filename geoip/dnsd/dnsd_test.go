@@ -0,0 +1,168 @@
+package dnsd
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/xofyarg/goutil/geoip"
+	"github.com/xofyarg/goutil/geoip/special"
+)
+
+func query(name string, qtype uint16) []byte {
+	msg := []byte{0x12, 0x34, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0}
+	for _, l := range strings.Split(strings.Trim(name, "."), ".") {
+		msg = append(msg, byte(len(l)))
+		msg = append(msg, l...)
+	}
+	msg = append(msg, 0, byte(qtype>>8), byte(qtype), 0, classIN)
+	return msg
+}
+
+// parse returns the rcode and the TXT strings of a response.
+func parse(t *testing.T, resp []byte) (int, []string) {
+	if len(resp) < headerLen || resp[0] != 0x12 || resp[1] != 0x34 {
+		t.Fatalf("bad response: %v", resp)
+	}
+	rcode := int(resp[3] & 0xf)
+	if binary.BigEndian.Uint16(resp[6:]) == 0 {
+		return rcode, nil
+	}
+
+	_, off, err := parseName(resp, headerLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// skip question, name pointer, type, class and ttl
+	off += 4 + 2 + 2 + 2 + 4
+	n := int(binary.BigEndian.Uint16(resp[off:]))
+	rdata := resp[off+2 : off+2+n]
+
+	var ss []string
+	for len(rdata) > 0 {
+		l := int(rdata[0])
+		ss = append(ss, string(rdata[1:1+l]))
+		rdata = rdata[1+l:]
+	}
+	return rcode, ss
+}
+
+func newServer() *Server {
+	t := special.NewTable()
+	return New("Origin.Example.", func() *geoip.Tree { return t })
+}
+
+func TestAnswer(t *testing.T) {
+	s := newServer()
+	cases := []struct {
+		name  string
+		qtype uint16
+		rcode int
+		txt   string
+	}{
+		{"1.0.0.10.origin.example", typeTXT, 0, "private | 10.0.0.0/8"},
+		{"1.0.0.127.ORIGIN.example", typeANY, 0, "loopback | 127.0.0.0/8"},
+		{"1.0.0.127.origin.example", 1, 0, ""},
+		{"8.8.8.8.origin.example", typeTXT, rcodeNXDomain, ""},
+		{"0.0.10.origin.example", typeTXT, 0, ""},
+		{"10.origin.example", typeTXT, 0, ""},
+		{"8.8.origin.example", typeANY, 0, ""},
+		{"01.0.0.10.origin.example", typeTXT, rcodeNXDomain, ""},
+		{"0.256.origin.example", typeTXT, rcodeNXDomain, ""},
+		{"x.10.origin.example", typeTXT, rcodeNXDomain, ""},
+		{"1.1.0.0.10.origin.example", typeTXT, rcodeNXDomain, ""},
+		{"origin.example", typeTXT, 0, ""},
+		{"1.0.0.10.other.example", typeTXT, rcodeRefused, ""},
+	}
+
+	for _, c := range cases {
+		rcode, txt := parse(t, s.Answer(query(c.name, c.qtype), udpMax))
+		if rcode != c.rcode || strings.Join(txt, "") != c.txt {
+			t.Errorf("name:[%s], want:[%d %s], get:[%d %v]", c.name, c.rcode, c.txt, rcode, txt)
+		}
+	}
+
+	if resp := s.Answer([]byte{1, 2, 3}, udpMax); resp != nil {
+		t.Errorf("want no response, get: %v", resp)
+	}
+	bad := query("1.0.0.10.origin.example", typeTXT)
+	if rcode, _ := parse(t, s.Answer(bad[:20], udpMax)); rcode != rcodeFormErr {
+		t.Errorf("want: %d, get: %d", rcodeFormErr, rcode)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	s := newServer()
+	s.Format = func(r *geoip.Record) []string {
+		return []string{strings.Repeat("x", 600)}
+	}
+
+	resp := s.Answer(query("1.0.0.10.origin.example", typeTXT), udpMax)
+	if resp[2]&0x02 == 0 || binary.BigEndian.Uint16(resp[6:]) != 0 {
+		t.Errorf("want truncated, get: %v", resp[:headerLen])
+	}
+
+	_, txt := parse(t, s.Answer(query("1.0.0.10.origin.example", typeTXT), tcpMax))
+	if strings.Join(txt, "") != strings.Repeat("x", 600) || len(txt) != 3 {
+		t.Errorf("get: %v", txt)
+	}
+}
+
+func TestServe(t *testing.T) {
+	s := newServer()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go s.ServeUDP(pc)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go s.ServeTCP(l)
+
+	q := query("1.2.254.169.origin.example", typeTXT)
+	exp := "link-local | 169.254.0.0/16"
+
+	c, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Write(q)
+	buf := make([]byte, udpMax)
+	n, err := c.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, txt := parse(t, buf[:n]); strings.Join(txt, "") != exp {
+		t.Errorf("udp get: %v", txt)
+	}
+
+	tc, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc.Close()
+	for i := 0; i < 2; i++ {
+		msg := []byte{byte(len(q) >> 8), byte(len(q))}
+		tc.Write(append(msg, q...))
+		var head [2]byte
+		if _, err := io.ReadFull(tc, head[:]); err != nil {
+			t.Fatal(err)
+		}
+		resp := make([]byte, binary.BigEndian.Uint16(head[:]))
+		if _, err := io.ReadFull(tc, resp); err != nil {
+			t.Fatal(err)
+		}
+		if _, txt := parse(t, resp); strings.Join(txt, "") != exp {
+			t.Errorf("tcp get: %v", txt)
+		}
+	}
+}
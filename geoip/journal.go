@@ -0,0 +1,198 @@
+package geoip
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+// Op is the kind of a change in a journal.
+type Op byte
+
+const (
+	// OpAdd adds the record with its source, overwriting the
+	// overlapped ones regardless of source priority.
+	OpAdd Op = iota + 1
+	// OpDelete removes the addresses of the record prefix associated
+	// with its payload, so a delta never drops data it did not know.
+	OpDelete
+)
+
+func (o Op) String() string {
+	switch o {
+	case OpAdd:
+		return "add"
+	case OpDelete:
+		return "delete"
+	default:
+		return fmt.Sprintf("op(%d)", byte(o))
+	}
+}
+
+// Change is an entry of a journal.
+type Change struct {
+	Op     Op
+	Record *Record
+}
+
+// Apply makes the change on t.
+func (c *Change) Apply(t *Tree) {
+	switch c.Op {
+	case OpAdd:
+		r := *c.Record
+		r.s = t.t.known(r.s)
+		t.t.add(&r, t.t.source(r.s), func(*node) bool { return true }, true)
+	case OpDelete:
+		t.DeleteRecord(c.Record)
+	}
+}
+
+// Journal is an append-only log of changes made to a tree snapshot.
+// Each change is written in the binary record format of Save,
+// including the source, after the op and followed by a CRC-32 of the
+// entry, with a single Write call, so a journal file can be appended
+// to across restarts and shipped as a small delta. All non-nil
+// payloads must implement Marshaler.
+type Journal struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf []byte
+}
+
+// NewJournal creates a journal appending to w.
+func NewJournal(w io.Writer) *Journal {
+	return &Journal{w: w}
+}
+
+// Add logs the addition of r.
+func (j *Journal) Add(r *Record) error {
+	return j.Write(&Change{Op: OpAdd, Record: r})
+}
+
+// Delete logs the deletion of r.
+func (j *Journal) Delete(r *Record) error {
+	return j.Write(&Change{Op: OpDelete, Record: r})
+}
+
+// Write logs c.
+func (j *Journal) Write(c *Change) error {
+	if c.Op != OpAdd && c.Op != OpDelete {
+		return fmt.Errorf("%s: %w", c.Op, ErrFormat)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	b, err := appendRecord(append(j.buf[:0], byte(c.Op)), c.Record)
+	if err != nil {
+		return err
+	}
+	b = binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b))
+	j.buf = b
+	_, err = j.w.Write(b)
+	return err
+}
+
+// JournalReader reads the changes of a journal.
+type JournalReader struct {
+	r    *bufio.Reader
+	crc  hash.Hash32
+	srcs sources
+}
+
+// NewJournalReader creates a reader of the journal r.
+func NewJournalReader(r io.Reader) *JournalReader {
+	return &JournalReader{
+		r:    bufio.NewReader(r),
+		crc:  crc32.NewIEEE(),
+		srcs: make(sources),
+	}
+}
+
+// Read returns the next change, or io.EOF at the end of the journal.
+// A truncated or corrupted entry is reported as ErrFormat.
+func (jr *JournalReader) Read() (*Change, error) {
+	jr.crc.Reset()
+	cr := crcReader{jr.r, jr.crc}
+
+	op, err := cr.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if Op(op) != OpAdd && Op(op) != OpDelete {
+		return nil, fmt.Errorf("%s: %w", Op(op), ErrFormat)
+	}
+
+	r, err := readRecord(cr, jr.srcs)
+	if err == io.EOF {
+		return nil, ErrFormat
+	} else if err != nil {
+		return nil, err
+	}
+
+	sum := jr.crc.Sum32()
+	var b [4]byte
+	if _, err := io.ReadFull(jr.r, b[:]); err != nil {
+		return nil, ErrFormat
+	}
+	if binary.BigEndian.Uint32(b[:]) != sum {
+		return nil, fmt.Errorf("checksum mismatch: %w", ErrFormat)
+	}
+	return &Change{Op: Op(op), Record: r}, nil
+}
+
+// crcReader hashes the bytes read.
+type crcReader struct {
+	r *bufio.Reader
+	h hash.Hash32
+}
+
+func (c crcReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.h.Write(p[:n])
+	return n, err
+}
+
+func (c crcReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.h.Write([]byte{b})
+	}
+	return b, err
+}
+
+// Replay applies the changes of the journal r on t in order, and
+// returns the number of changes applied. On error, the changes before
+// the failed one are kept.
+func (t *Tree) Replay(r io.Reader) (int, error) {
+	jr := NewJournalReader(r)
+	for n := 0; ; n++ {
+		c, err := jr.Read()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, fmt.Errorf("change %d: %w", n+1, err)
+		}
+		c.Apply(t)
+	}
+}
+
+// Compact folds the journal into the snapshot written by Save, and
+// writes the new snapshot to w. It returns the number of changes
+// applied.
+func Compact(w io.Writer, snapshot, journal io.Reader) (int, error) {
+	t, err := LoadBinary(snapshot)
+	if err != nil {
+		return 0, err
+	}
+	n, err := t.Replay(journal)
+	if err != nil {
+		return n, err
+	}
+	return n, t.Save(w)
+}
@@ -0,0 +1,106 @@
+package geoip
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestDelete(t *testing.T) {
+	cases := []struct {
+		del string
+		o   string
+	}{
+		{"1.0.0.0/24", "10.0.0.0/8 (B)"},
+		{"1.0.0.0/26", "1.0.0.64/26 (A)\n1.0.0.128/25 (A)\n10.0.0.0/8 (B)"},
+		{"1.0.0.255/32", "1.0.0.0/25 (A)\n1.0.0.128/26 (A)\n" +
+			"1.0.0.192/27 (A)\n1.0.0.224/28 (A)\n1.0.0.240/29 (A)\n" +
+			"1.0.0.248/30 (A)\n1.0.0.252/31 (A)\n1.0.0.254/32 (A)\n" +
+			"10.0.0.0/8 (B)"},
+		{"0.0.0.0/6", "10.0.0.0/8 (B)"},
+		{"8.0.0.0/5", "1.0.0.0/24 (A)"},
+		{"0.0.0.0/0", ""},
+		{"192.168.0.0/16", "1.0.0.0/24 (A)\n10.0.0.0/8 (B)"},
+	}
+
+	for _, c := range cases {
+		ta := NewTable()
+		ta.Add(rec("1.0.0.0/24", "A"), false)
+		ta.Add(rec("10.0.0.0/8", "B"), false)
+
+		_, cidr, _ := net.ParseCIDR(c.del)
+		if err := ta.Delete(cidr); err != nil {
+			t.Fatal(err)
+		}
+		if out := ta.Dump(); out != c.o {
+			t.Errorf("delete:[%s], want: [%s]\nget: [%s]", c.del, c.o, out)
+		}
+	}
+}
+
+func TestDeleteRecord(t *testing.T) {
+	ta := NewTable()
+	ta.Add(rec("1.0.0.0/24", "A"), false)
+	ta.Add(rec("1.0.0.128/25", "B"), true)
+	ta.DeleteRecord(rec("1.0.0.0/16", "B"))
+	ta.DeleteRecord(rec("1.0.0.0/25", "C"))
+
+	exp := "1.0.0.0/25 (A)"
+	if out := ta.Dump(); out != exp {
+		t.Errorf("want: [%s]\nget: [%s]", exp, out)
+	}
+
+	// the space left can be added again
+	ta.Add(rec("1.0.0.128/25", "A"), false)
+	exp = "1.0.0.0/24 (A)"
+	if out := ta.Dump(); out != exp {
+		t.Errorf("want: [%s]\nget: [%s]", exp, out)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	var snap bytes.Buffer
+	ta := sampleTree()
+	if err := ta.Save(&snap); err != nil {
+		t.Fatal(err)
+	}
+
+	var log bytes.Buffer
+	j := NewJournal(&log)
+	j.Add(rec("1.0.0.0/29", "D"))
+	j.Delete(rec("10.0.0.0/9", "C\n\""))
+	j.Delete(rec("20.0.0.0/8", "X"))
+	j.Add(rec("30.0.0.0/8", "E"))
+	if err := j.Add(NewRecordFromCIDR(rec("40.0.0.0/8", "").Prefix(), pn(1))); !errors.Is(err, ErrNoMarshal) {
+		t.Errorf("want:[%v], get:[%v]", ErrNoMarshal, err)
+	}
+
+	var out bytes.Buffer
+	n, err := Compact(&out, bytes.NewReader(snap.Bytes()), bytes.NewReader(log.Bytes()))
+	if err != nil || n != 4 {
+		t.Fatalf("want: 4 changes, get: %d, %v", n, err)
+	}
+	lt, err := LoadBinary(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := "0.0.0.0/32 ()\n1.0.0.0/29 (D)\n1.0.0.8/30 (A)\n" +
+		"10.128.0.0/9 (\"C\\n\\\"\")\n20.0.0.0/8 (-)\n30.0.0.0/8 (E)"
+	if out := lt.Dump(); out != exp {
+		t.Errorf("want: [%s]\nget: [%s]", exp, out)
+	}
+
+	// a torn write at the end
+	b := log.Bytes()
+	n, err = sampleTree().Replay(bytes.NewReader(b[:len(b)-1]))
+	if n != 3 || !errors.Is(err, ErrFormat) {
+		t.Errorf("want: 3, %v, get: %d, %v", ErrFormat, n, err)
+	}
+
+	b[3] ^= 1
+	if _, err := sampleTree().Replay(bytes.NewReader(b)); !errors.Is(err, ErrFormat) {
+		t.Errorf("want:[%v], get:[%v]", ErrFormat, err)
+	}
+}
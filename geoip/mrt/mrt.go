@@ -0,0 +1,332 @@
+// Package mrt imports BGP routing tables in MRT TABLE_DUMP_V2 format
+// (RFC 6396), as published by RouteViews and RIPE RIS, into geoip
+// tables of origin AS numbers.
+//
+// Basic usage:
+//
+//	f, _ := os.Open("rib.20240101.0000.bz2")
+//	t, err := mrt.Load(f)
+//	v, ok := t.Lookup(ip) // v.(mrt.ASN)
+package mrt
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/xofyarg/goutil/geoip"
+)
+
+const (
+	typeTableDumpV2 = 13
+
+	subtypeRIBIPv4Unicast        = 2
+	subtypeRIBIPv4UnicastAddPath = 8
+
+	attrASPath   = 2
+	attrExtended = 0x10
+
+	segASSet      = 1
+	segASSequence = 2
+
+	headerLen = 12
+	// sanity limit of a record
+	maxRecord = 1 << 24
+)
+
+var ErrFormat = errors.New("invalid MRT data")
+
+// ASN is an AS number, the payload of the tables built by Load.
+type ASN uint32
+
+// Equal implements geoip.Payload.
+func (a ASN) Equal(p geoip.Payload) bool {
+	o, ok := p.(ASN)
+	return ok && o == a
+}
+
+// String implements geoip.Payload.
+func (a ASN) String() string {
+	return fmt.Sprintf("AS%d", uint32(a))
+}
+
+// Tag implements geoip.Marshaler.
+func (a ASN) Tag() string {
+	return "asn"
+}
+
+// MarshalBinary implements geoip.Marshaler.
+func (a ASN) MarshalBinary() ([]byte, error) {
+	return binary.BigEndian.AppendUint32(nil, uint32(a)), nil
+}
+
+// MarshalJSON implements geoip.Marshaler.
+func (a ASN) MarshalJSON() ([]byte, error) {
+	return json.Marshal(uint32(a))
+}
+
+func init() {
+	geoip.Register(ASN(0).Tag(), geoip.Decoder{
+		Binary: func(data []byte) (geoip.Payload, error) {
+			if len(data) != 4 {
+				return nil, fmt.Errorf("asn: invalid length %d", len(data))
+			}
+			return ASN(binary.BigEndian.Uint32(data)), nil
+		},
+		JSON: func(data []byte) (geoip.Payload, error) {
+			var n uint32
+			err := json.Unmarshal(data, &n)
+			return ASN(n), err
+		},
+	})
+}
+
+// Prefix is a RIB entry of an IPv4 prefix.
+type Prefix struct {
+	Net *net.IPNet
+	// origin AS of each path, paths without a single origin are
+	// skipped
+	Origins []ASN
+}
+
+// Origin returns the most common origin of the paths, the smallest
+// one on ties. It returns false if no path has an origin.
+func (p *Prefix) Origin() (ASN, bool) {
+	count := make(map[ASN]int)
+	for _, a := range p.Origins {
+		count[a]++
+	}
+
+	var best ASN
+	var most int
+	for a, n := range count {
+		if n > most || (n == most && a < best) {
+			best = a
+			most = n
+		}
+	}
+	return best, most > 0
+}
+
+// Reader reads IPv4 unicast RIB entries from an MRT stream, other
+// records are skipped.
+type Reader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// NewReader creates a reader of the uncompressed MRT stream r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next IPv4 unicast RIB entry, or io.EOF at the end
+// of the stream.
+func (r *Reader) Next() (*Prefix, error) {
+	var hdr [headerLen]byte
+	for {
+		if _, err := io.ReadFull(r.r, hdr[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = ErrFormat
+			}
+			return nil, err
+		}
+
+		typ := binary.BigEndian.Uint16(hdr[4:])
+		sub := binary.BigEndian.Uint16(hdr[6:])
+		n := binary.BigEndian.Uint32(hdr[8:])
+		if n > maxRecord {
+			return nil, fmt.Errorf("record length %d: %w", n, ErrFormat)
+		}
+
+		if cap(r.buf) < int(n) {
+			r.buf = make([]byte, n)
+		}
+		data := r.buf[:n]
+		if _, err := io.ReadFull(r.r, data); err != nil {
+			return nil, ErrFormat
+		}
+
+		if typ != typeTableDumpV2 {
+			continue
+		}
+		switch sub {
+		case subtypeRIBIPv4Unicast:
+			return parseRIB(data, false)
+		case subtypeRIBIPv4UnicastAddPath:
+			return parseRIB(data, true)
+		}
+	}
+}
+
+// parseRIB parses a RIB_IPV4_UNICAST record.
+func parseRIB(data []byte, addPath bool) (*Prefix, error) {
+	d := decoder{data: data}
+	d.skip(4) // sequence number
+	size := int(d.u8())
+	if size > 32 {
+		return nil, fmt.Errorf("prefix length %d: %w", size, ErrFormat)
+	}
+
+	var ip [4]byte
+	copy(ip[:], d.bytes((size+7)/8))
+	mask := net.CIDRMask(size, 32)
+	p := &Prefix{
+		Net: &net.IPNet{IP: net.IP(ip[:]).Mask(mask), Mask: mask},
+	}
+
+	entries := int(d.u16())
+	for i := 0; i < entries && d.err == nil; i++ {
+		d.skip(2 + 4) // peer index, originated time
+		if addPath {
+			d.skip(4) // path identifier
+		}
+		attrs := d.bytes(int(d.u16()))
+		if a, ok := origin(attrs); ok {
+			p.Origins = append(p.Origins, a)
+		}
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	return p, nil
+}
+
+// origin finds the origin AS in BGP path attributes, AS numbers are
+// always 4 bytes in TABLE_DUMP_V2.
+func origin(attrs []byte) (ASN, bool) {
+	d := decoder{data: attrs}
+	for d.err == nil && len(d.data) > 0 {
+		flags := d.u8()
+		typ := d.u8()
+		var n int
+		if flags&attrExtended != 0 {
+			n = int(d.u16())
+		} else {
+			n = int(d.u8())
+		}
+		value := d.bytes(n)
+		if d.err != nil || typ != attrASPath {
+			continue
+		}
+
+		// the origin is the last AS of the last segment, an AS_SET
+		// is only accepted with one member
+		var last ASN
+		var ok bool
+		seg := decoder{data: value}
+		for seg.err == nil && len(seg.data) > 0 {
+			st := seg.u8()
+			count := int(seg.u8())
+			asns := seg.bytes(count * 4)
+			if seg.err != nil || count == 0 {
+				break
+			}
+			switch {
+			case st == segASSequence, st == segASSet && count == 1:
+				last = ASN(binary.BigEndian.Uint32(asns[len(asns)-4:]))
+				ok = true
+			default:
+				ok = false
+			}
+		}
+		return last, ok && seg.err == nil
+	}
+	return 0, false
+}
+
+// decoder reads big endian fields, the first error is kept.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.data) {
+		d.err = ErrFormat
+		d.data = nil
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) skip(n int) {
+	d.bytes(n)
+}
+
+func (d *decoder) u8() uint8 {
+	if b := d.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) u16() uint16 {
+	if b := d.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+// Load reads an MRT RIB dump, gzip or bzip2 compressed or not, and
+// builds a table of the origin AS of each prefix. More specific
+// prefixes take precedence over the ones covering them.
+func Load(r io.Reader) (*geoip.Tree, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(3)
+
+	var in io.Reader = br
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		in = gr
+	case bytes.Equal(magic, []byte("BZh")):
+		in = bzip2.NewReader(br)
+	}
+
+	// records by prefix length, so less specific prefixes are added
+	// first and overwritten by more specific ones
+	var bySize [33][]*geoip.Record
+	mr := NewReader(in)
+	for {
+		p, err := mr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		a, ok := p.Origin()
+		if !ok {
+			continue
+		}
+		size, _ := p.Net.Mask.Size()
+		bySize[size] = append(bySize[size], geoip.NewRecordFromCIDR(p.Net, a))
+	}
+
+	t := geoip.NewTable()
+	for _, rs := range bySize {
+		for _, r := range rs {
+			t.Add(r, true)
+		}
+	}
+	return t, nil
+}
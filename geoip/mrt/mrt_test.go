@@ -0,0 +1,186 @@
+package mrt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+// record builds an MRT record.
+func record(typ, sub uint16, data []byte) []byte {
+	b := make([]byte, headerLen, headerLen+len(data))
+	binary.BigEndian.PutUint16(b[4:], typ)
+	binary.BigEndian.PutUint16(b[6:], sub)
+	binary.BigEndian.PutUint32(b[8:], uint32(len(data)))
+	return append(b, data...)
+}
+
+// path builds the attributes of a path with an AS_SEQUENCE, followed
+// by an AS_SET if set is not empty.
+func path(seq []uint32, set ...uint32) []byte {
+	var v []byte
+	segs := []struct {
+		typ  byte
+		asns []uint32
+	}{{segASSequence, seq}, {segASSet, set}}
+	for _, s := range segs {
+		if len(s.asns) == 0 {
+			continue
+		}
+		v = append(v, s.typ, byte(len(s.asns)))
+		for _, a := range s.asns {
+			v = binary.BigEndian.AppendUint32(v, a)
+		}
+	}
+
+	// ORIGIN, then AS_PATH with extended length
+	b := []byte{0x40, 1, 1, 0}
+	b = append(b, 0x50, attrASPath)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(v)))
+	return append(b, v...)
+}
+
+// rib builds a RIB_IPV4_UNICAST record.
+func rib(prefix string, paths ...[]byte) []byte {
+	_, n, _ := net.ParseCIDR(prefix)
+	size, _ := n.Mask.Size()
+
+	b := []byte{0, 0, 0, 1, byte(size)}
+	b = append(b, n.IP.To4()[:(size+7)/8]...)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(paths)))
+	for i, p := range paths {
+		b = binary.BigEndian.AppendUint16(b, uint16(i))
+		b = append(b, 0, 0, 0, 0)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(p)))
+		b = append(b, p...)
+	}
+	return record(typeTableDumpV2, subtypeRIBIPv4Unicast, b)
+}
+
+func dump() []byte {
+	var b []byte
+	// peer index table and IPv6 RIB are skipped
+	b = append(b, record(typeTableDumpV2, 1, []byte{1, 2, 3, 4, 0, 0, 0, 0})...)
+	b = append(b, rib("10.0.0.0/8",
+		path([]uint32{100, 200}),
+		path([]uint32{300, 65001}),
+		path([]uint32{400, 200}))...)
+	b = append(b, record(typeTableDumpV2, 4, []byte{0, 0, 0, 2, 0, 0, 0})...)
+	b = append(b, rib("10.1.0.0/16", path([]uint32{100, 300}))...)
+	b = append(b, rib("192.0.2.0/24",
+		path([]uint32{100}, 500),
+		path([]uint32{100}, 600, 700))...)
+	b = append(b, rib("198.51.100.0/24", path([]uint32{100}, 600, 700))...)
+	return b
+}
+
+func TestReader(t *testing.T) {
+	r := NewReader(bytes.NewReader(dump()))
+	exp := []struct {
+		prefix  string
+		origins []ASN
+	}{
+		{"10.0.0.0/8", []ASN{200, 65001, 200}},
+		{"10.1.0.0/16", []ASN{300}},
+		{"192.0.2.0/24", []ASN{500}},
+		{"198.51.100.0/24", nil},
+	}
+
+	for _, e := range exp {
+		p, err := r.Next()
+		if err != nil {
+			t.Fatalf("prefix:[%s], error: %v", e.prefix, err)
+		}
+		if p.Net.String() != e.prefix {
+			t.Errorf("want:[%s], get:[%s]", e.prefix, p.Net)
+		}
+		if len(p.Origins) != len(e.origins) {
+			t.Errorf("prefix:[%s], want:%v, get:%v", e.prefix, e.origins, p.Origins)
+			continue
+		}
+		for i := range e.origins {
+			if p.Origins[i] != e.origins[i] {
+				t.Errorf("prefix:[%s], want:%v, get:%v", e.prefix, e.origins, p.Origins)
+				break
+			}
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("want: EOF, get: %v", err)
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	cases := []struct {
+		origins []ASN
+		exp     ASN
+		ok      bool
+	}{
+		{nil, 0, false},
+		{[]ASN{1}, 1, true},
+		{[]ASN{3, 2, 3}, 3, true},
+		{[]ASN{3, 2}, 2, true},
+	}
+	for _, c := range cases {
+		p := Prefix{Origins: c.origins}
+		a, ok := p.Origin()
+		if a != c.exp || ok != c.ok {
+			t.Errorf("origins:%v, want:[%d %v], get:[%d %v]", c.origins, c.exp, c.ok, a, ok)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(dump())
+	w.Close()
+
+	for name, data := range map[string][]byte{"raw": dump(), "gzip": gz.Bytes()} {
+		ta, err := Load(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		cases := map[string]ASN{
+			"10.2.3.4":       200,
+			"10.1.2.3":       300,
+			"192.0.2.1":      500,
+			"198.51.100.1":   0,
+			"203.0.113.1":    0,
+			"10.255.255.255": 200,
+		}
+		for ip, exp := range cases {
+			v, ok := ta.Lookup(net.ParseIP(ip))
+			if exp == 0 {
+				if ok {
+					t.Errorf("%s: ip:[%s], want: none, get:[%s]", name, ip, v)
+				}
+				continue
+			}
+			if !ok || v != exp {
+				t.Errorf("%s: ip:[%s], want:[%s], get:[%v]", name, ip, exp, v)
+			}
+		}
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	b := dump()
+	_, err := Load(bytes.NewReader(b[:len(b)-3]))
+	if !errors.Is(err, ErrFormat) {
+		t.Errorf("want:[%v], get:[%v]", ErrFormat, err)
+	}
+
+	// entry count beyond the record
+	b = rib("10.0.0.0/8", path([]uint32{1}))
+	b[headerLen+4+1+1+1] = 2
+	_, err = NewReader(bytes.NewReader(b)).Next()
+	if !errors.Is(err, ErrFormat) {
+		t.Errorf("want:[%v], get:[%v]", ErrFormat, err)
+	}
+}
@@ -0,0 +1,140 @@
+package geoip
+
+import (
+	"net"
+	"strings"
+)
+
+type nnode[T any] struct {
+	c   [2]*nnode[T]
+	v   T
+	set bool
+}
+
+// NestedOf is a radix tree keeping each added prefix as its own entry
+// instead of flattening overlapped prefixes into disjoint leaves, like
+// a routing table. The zero value is an empty tree.
+type NestedOf[T any] struct {
+	root nnode[T]
+	n    int
+}
+
+// Nested is a NestedOf storing Payload.
+type Nested = NestedOf[Payload]
+
+// NewNested creates a empty nested tree of Payload.
+func NewNested() *Nested {
+	return &Nested{}
+}
+
+// NewNestedOf creates a empty nested tree of values of type T.
+func NewNestedOf[T any]() *NestedOf[T] {
+	return &NestedOf[T]{}
+}
+
+// Add inserts a record as an entry. overwrite controls the behaivor
+// when an entry with the same prefix exists. If true, the latter
+// wins.
+func (t *NestedOf[T]) Add(r *RecordOf[T], overwrite bool) {
+	prefix := r.i.prefix
+	n := &t.root
+	for depth := 1; depth <= r.i.size; depth++ {
+		b := prefix >> 31
+		prefix <<= 1
+		if n.c[b] == nil {
+			n.c[b] = &nnode[T]{}
+		}
+		n = n.c[b]
+	}
+
+	if n.set && !overwrite {
+		return
+	}
+	if !n.set {
+		t.n++
+	}
+	n.v = r.v
+	n.set = true
+}
+
+// Len returns the number of entries.
+func (t *NestedOf[T]) Len() int {
+	return t.n
+}
+
+// Lookup find the value of the most specific entry covering an IP. It
+// returns the value and true on success, otherwise, returns false,
+// and the value returned is undefined.
+func (t *NestedOf[T]) Lookup(ip net.IP) (T, bool) {
+	var v T
+	var found bool
+	t.match(ip, func(n *nnode[T], prefix uint32, depth int) {
+		v = n.v
+		found = true
+	})
+	return v, found
+}
+
+// Covering returns all the entries covering an IP, from the most
+// specific to the least specific one.
+func (t *NestedOf[T]) Covering(ip net.IP) []*RecordOf[T] {
+	var rs []*RecordOf[T]
+	t.match(ip, func(n *nnode[T], prefix uint32, depth int) {
+		r := &RecordOf[T]{
+			i: cidr{prefix: prefix, size: depth},
+			v: n.v,
+		}
+		rs = append([]*RecordOf[T]{r}, rs...)
+	})
+	return rs
+}
+
+// match calls cb on every entry covering ip, from the least specific
+// to the most specific one.
+func (t *NestedOf[T]) match(ip net.IP, cb func(n *nnode[T], prefix uint32, depth int)) {
+	if t == nil {
+		return
+	}
+
+	addr := ipToNum(ip)
+	n := &t.root
+	for depth := 0; n != nil; depth++ {
+		if n.set {
+			cb(n, addr&sizeToMask(depth), depth)
+		}
+		if depth == 32 {
+			break
+		}
+		n = n.c[(addr<<uint(depth))>>31]
+	}
+}
+
+// Dump prints all the entries inside the tree one by one, an entry
+// comes before the ones nested in it.
+func (t *NestedOf[T]) Dump() string {
+	var s []string
+	t.walk(func(r *RecordOf[T]) {
+		s = append(s, r.String())
+	})
+	return strings.Join(s, "\n")
+}
+
+func (t *NestedOf[T]) walk(cb func(r *RecordOf[T])) {
+	var f func(n *nnode[T], prefix uint32, depth int)
+	f = func(n *nnode[T], prefix uint32, depth int) {
+		if n.set {
+			cb(&RecordOf[T]{
+				i: cidr{prefix: prefix, size: depth},
+				v: n.v,
+			})
+		}
+		if n.c[0] != nil {
+			f(n.c[0], prefix, depth+1)
+		}
+		if n.c[1] != nil {
+			f(n.c[1], prefix|1<<uint(31-depth), depth+1)
+		}
+	}
+
+	f(&t.root, 0, 0)
+}
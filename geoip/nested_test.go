@@ -0,0 +1,72 @@
+package geoip
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func nestedSample() *Nested {
+	ta := NewNested()
+	for _, in := range []input{
+		{"10.0.0.0/8", "A", false},
+		{"10.1.0.0/16", "B", false},
+		{"10.1.2.0/24", "C", false},
+		{"10.1.0.0/16", "X", false},
+		{"0.0.0.0/0", "D", false},
+		{"10.1.2.3/32", "E", false},
+	} {
+		_, cidr, _ := net.ParseCIDR(in.cidr)
+		ta.Add(NewRecordFromCIDR(cidr, in.payload), in.overwrite)
+	}
+	return ta
+}
+
+func TestNestedDump(t *testing.T) {
+	ta := nestedSample()
+	exp := "0.0.0.0/0 (D)\n10.0.0.0/8 (A)\n10.1.0.0/16 (B)\n10.1.2.0/24 (C)\n10.1.2.3/32 (E)"
+	if out := ta.Dump(); out != exp {
+		t.Errorf("want: [%s]\nget: [%s]", exp, out)
+	}
+	if ta.Len() != 5 {
+		t.Errorf("want: 5, get: %d", ta.Len())
+	}
+
+	_, cidr, _ := net.ParseCIDR("10.1.0.0/16")
+	ta.Add(NewRecordFromCIDR(cidr, ps("X")), true)
+	if v, _ := ta.Lookup(net.ParseIP("10.1.3.1")); v != ps("X") {
+		t.Errorf("want: X, get: %v", v)
+	}
+}
+
+func TestNestedLookup(t *testing.T) {
+	ta := nestedSample()
+	cases := map[string]string{
+		"10.1.2.3": "E",
+		"10.1.2.4": "C",
+		"10.1.3.1": "B",
+		"10.2.0.0": "A",
+		"11.0.0.0": "D",
+	}
+	for ip, exp := range cases {
+		if v, ok := ta.Lookup(net.ParseIP(ip)); !ok || v != ps(exp) {
+			t.Errorf("ip:[%s], want:[%s], get:[%v]", ip, exp, v)
+		}
+	}
+
+	if _, ok := NewNested().Lookup(net.ParseIP("1.2.3.4")); ok {
+		t.Errorf("want: none")
+	}
+}
+
+func TestNestedCovering(t *testing.T) {
+	ta := nestedSample()
+	var l []string
+	for _, r := range ta.Covering(net.ParseIP("10.1.2.4")) {
+		l = append(l, r.String())
+	}
+	exp := "10.1.2.0/24 (C)|10.1.0.0/16 (B)|10.0.0.0/8 (A)|0.0.0.0/0 (D)"
+	if out := strings.Join(l, "|"); out != exp {
+		t.Errorf("want: [%s]\nget: [%s]", exp, out)
+	}
+}
@@ -3,14 +3,33 @@
 //
 // Basic usage:
 //   1. create a empty table: NewTable
-//   2. convert current database into records: NewRecordFrom{CIDR,Range}
+//   2. convert current database into records: NewRecordFrom{CIDR,Range},
+//      or the validating ones: RecordFromCIDR, RecordsFromRange,
+//      Parse{CIDR,Range}
 //   3. add these records into table: table.Add
 //   4. future operation: table.Lookup/table.Dump
+//   5. read a dumped table back: Load
+//
+// Small updates can be logged with a Journal, replayed onto a saved
+// table with table.Replay, and folded into a new snapshot by Compact.
+//
+// TreeOf is the generic form of Tree storing values of any type, see
+// NewTreeOf and NewTreeFunc.
 package geoip
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrFamily   = errors.New("not an IPv4 address")
+	ErrHostBits = errors.New("host bits set in prefix")
+	ErrInvRange = errors.New("range start after end")
+	ErrSyntax   = errors.New("invalid syntax")
 )
 
 // use cidr internally instead of IPNet for speed
@@ -35,19 +54,82 @@ type Payload interface {
 	String() string
 }
 
-// Record is used to store a CIDR and its associated payload.
-type Record struct {
+// RecordOf is used to store a CIDR and its associated value of type
+// T, it is the record type of TreeOf.
+type RecordOf[T any] struct {
 	i cidr
-	v Payload
+	v T
+	s *Source
 }
 
+// Record is used to store a CIDR and its associated payload.
+type Record = RecordOf[Payload]
+
 // String will convert internal ip set into a cidr, and then call
-// payload's string method.
-func (r *Record) String() string {
-	if _, ok := r.v.(fmt.Stringer); ok {
-		return fmt.Sprintf("%s (%s)", &r.i, r.v)
+// payload's string method. The name of the source is appended if
+// known. Texts that would not read back are quoted, see quote.
+func (r *RecordOf[T]) String() string {
+	var s string
+	switch v := any(r.v).(type) {
+	case nil:
+		s = fmt.Sprintf("%s (-)", &r.i)
+	case fmt.Stringer:
+		s = fmt.Sprintf("%s (%s)", &r.i, quote(v.String(), ')'))
+	default:
+		s = fmt.Sprintf("%s (%s)", &r.i, quote(fmt.Sprint(v), ')'))
+	}
+
+	if r.s != nil {
+		s += fmt.Sprintf(" [%s]", quote(r.s.Name, ']'))
 	}
-	return fmt.Sprintf("%s (-)", &r.i)
+	return s
+}
+
+// quote returns s as a Go string literal if it has line breaks,
+// quotes or the byte end closing it, which would break the line
+// format of Dump, s itself otherwise.
+func quote(s string, end byte) string {
+	if strings.ContainsAny(s, "\n\r\"") || strings.IndexByte(s, end) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// unquote reads a text written by quote from the start of s, up to
+// the byte end. It returns the text and the rest of s after end.
+func unquote(s string, end byte) (string, string, error) {
+	if strings.HasPrefix(s, "\"") {
+		q, err := strconv.QuotedPrefix(s)
+		if err != nil || len(q) == len(s) || s[len(q)] != end {
+			return "", "", ErrSyntax
+		}
+		t, _ := strconv.Unquote(q)
+		return t, s[len(q)+1:], nil
+	}
+
+	i := strings.IndexByte(s, end)
+	if i < 0 {
+		return "", "", ErrSyntax
+	}
+	return s[:i], s[i+1:], nil
+}
+
+// Prefix returns the CIDR of the record.
+func (r *RecordOf[T]) Prefix() *net.IPNet {
+	return &net.IPNet{
+		IP:   numToIP(r.i.prefix),
+		Mask: net.CIDRMask(r.i.size, 32),
+	}
+}
+
+// Payload returns the payload bound to the record.
+func (r *RecordOf[T]) Payload() T {
+	return r.v
+}
+
+// Source returns where the record comes from, nil if unknown.
+func (r *RecordOf[T]) Source() *Source {
+	return r.s
 }
 
 // NewRecordFromCIDR convert an IPNet structure into a Record.
@@ -78,6 +160,100 @@ func NewRecordFromRange(a, b net.IP, v Payload) []*Record {
 	return rs
 }
 
+// RecordFromCIDR is like NewRecordFromCIDR, but returns an error if
+// i is not an IPv4 network or has host bits set.
+func RecordFromCIDR(i *net.IPNet, v Payload) (*Record, error) {
+	return RecordOfCIDR(i, v)
+}
+
+// RecordOfCIDR is the generic form of RecordFromCIDR.
+func RecordOfCIDR[T any](i *net.IPNet, v T) (*RecordOf[T], error) {
+	if i == nil || i.IP.To4() == nil {
+		return nil, fmt.Errorf("%v: %w", i, ErrFamily)
+	}
+	size, bits := i.Mask.Size()
+	switch {
+	case bits == 32:
+	case bits == 128 && size >= 96 && len(i.IP) == net.IPv6len:
+		size -= 96
+	default:
+		return nil, fmt.Errorf("%v: %w", i, ErrFamily)
+	}
+
+	prefix := ipToNum(i.IP)
+	if prefix&^sizeToMask(size) != 0 {
+		return nil, fmt.Errorf("%v: %w", i, ErrHostBits)
+	}
+
+	return &RecordOf[T]{
+		i: cidr{
+			prefix: prefix,
+			size:   size,
+		},
+		v: v,
+	}, nil
+}
+
+// RecordsFromRange is like NewRecordFromRange, but returns an error
+// if a or b is not an IPv4 address, or a is after b.
+func RecordsFromRange(a, b net.IP, v Payload) ([]*Record, error) {
+	return RecordsOfRange(a, b, v)
+}
+
+// RecordsOfRange is the generic form of RecordsFromRange.
+func RecordsOfRange[T any](a, b net.IP, v T) ([]*RecordOf[T], error) {
+	if a.To4() == nil {
+		return nil, fmt.Errorf("%v: %w", a, ErrFamily)
+	}
+	if b.To4() == nil {
+		return nil, fmt.Errorf("%v: %w", b, ErrFamily)
+	}
+
+	low := ipToNum(a)
+	high := ipToNum(b)
+	if low > high {
+		return nil, fmt.Errorf("%v-%v: %w", a, b, ErrInvRange)
+	}
+
+	var rs []*RecordOf[T]
+	ns := rangeToSubnet(low, high)
+	for i := range ns {
+		rs = append(rs, &RecordOf[T]{i: ns[i], v: v})
+	}
+	return rs, nil
+}
+
+// ParseCIDR parses s in the form of "1.2.3.0/24" into a Record.
+func ParseCIDR(s string, v Payload) (*Record, error) {
+	ip, i, err := net.ParseCIDR(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", s, ErrSyntax)
+	}
+	if ip.To4() == nil {
+		return nil, fmt.Errorf("%q: %w", s, ErrFamily)
+	}
+	if !ip.Equal(i.IP) {
+		return nil, fmt.Errorf("%q: %w", s, ErrHostBits)
+	}
+	return RecordFromCIDR(i, v)
+}
+
+// ParseRange parses s in the form of "1.2.3.4-1.2.3.9" into a slice
+// of Record.
+func ParseRange(s string, v Payload) ([]*Record, error) {
+	f := strings.SplitN(s, "-", 2)
+	if len(f) != 2 {
+		return nil, fmt.Errorf("%q: %w", s, ErrSyntax)
+	}
+
+	a := net.ParseIP(strings.TrimSpace(f[0]))
+	b := net.ParseIP(strings.TrimSpace(f[1]))
+	if a == nil || b == nil {
+		return nil, fmt.Errorf("%q: %w", s, ErrSyntax)
+	}
+	return RecordsFromRange(a, b, v)
+}
+
 func rangeToSubnet(low, high uint32) []cidr {
 	if low > high {
 		low, high = high, low
@@ -131,6 +307,10 @@ func ipToNum(ip net.IP) uint32 {
 	return uint32(arr[0])<<24 | uint32(arr[1])<<16 | uint32(arr[2])<<8 | uint32(arr[3])
 }
 
+func numToIP(n uint32) net.IP {
+	return net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n)).To4()
+}
+
 func sizeToMask(n int) uint32 {
 	return ^uint32(0) << uint(32-n)
 }
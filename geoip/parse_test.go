@@ -1,6 +1,7 @@
 package geoip
 
 import (
+	"errors"
 	"net"
 	"strings"
 	"testing"
@@ -202,3 +203,132 @@ func TestAddMergeFrom(t *testing.T) {
 		},
 	)
 }
+
+func TestParseCIDR(t *testing.T) {
+	cases := map[string]error{
+		"1.2.3.0/24":   nil,
+		" 1.2.3.4/32 ": nil,
+		"1.2.3.4/24":   ErrHostBits,
+		"::1/128":      ErrFamily,
+		"1.2.3.0":      ErrSyntax,
+	}
+
+	for in, exp := range cases {
+		r, err := ParseCIDR(in, ps("A"))
+		if !errors.Is(err, exp) {
+			t.Errorf("in:[%s], want:[%v], get:[%v]", in, exp, err)
+			continue
+		}
+		if err == nil && r.Prefix().String() != strings.TrimSpace(in) {
+			t.Errorf("in:[%s], get prefix:[%s]", in, r.Prefix())
+		}
+	}
+}
+
+func TestRecordFromCIDR(t *testing.T) {
+	i := &net.IPNet{IP: net.ParseIP("1.2.3.4"), Mask: net.CIDRMask(24, 32)}
+	if _, err := RecordFromCIDR(i, nil); !errors.Is(err, ErrHostBits) {
+		t.Errorf("want:[%v], get:[%v]", ErrHostBits, err)
+	}
+
+	i = &net.IPNet{IP: net.ParseIP("2001:db8::"), Mask: net.CIDRMask(32, 128)}
+	if _, err := RecordFromCIDR(i, nil); !errors.Is(err, ErrFamily) {
+		t.Errorf("want:[%v], get:[%v]", ErrFamily, err)
+	}
+
+	if _, err := RecordFromCIDR(nil, nil); !errors.Is(err, ErrFamily) {
+		t.Errorf("want:[%v], get:[%v]", ErrFamily, err)
+	}
+
+	i = &net.IPNet{IP: net.ParseIP("1.2.3.0"), Mask: net.CIDRMask(120, 128)}
+	r, err := RecordFromCIDR(i, ps("A"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.String() != "1.2.3.0/24 (A)" || r.Payload() != ps("A") {
+		t.Errorf("get:[%s]", r)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	cases := map[string]error{
+		"1.2.3.4-1.2.3.9":   nil,
+		"1.2.3.4 - 1.2.3.4": nil,
+		"1.2.3.9-1.2.3.4":   ErrInvRange,
+		"1.2.3.4-::1":       ErrFamily,
+		"1.2.3.4":           ErrSyntax,
+		"1.2.3.4-x":         ErrSyntax,
+	}
+
+	for in, exp := range cases {
+		if _, err := ParseRange(in, nil); !errors.Is(err, exp) {
+			t.Errorf("in:[%s], want:[%v], get:[%v]", in, exp, err)
+		}
+	}
+
+	rs, _ := ParseRange("192.168.0.2-192.168.0.10", nil)
+	var l []string
+	for _, r := range rs {
+		l = append(l, r.Prefix().String())
+	}
+	exp := "192.168.0.2/31 192.168.0.4/30 192.168.0.8/31 192.168.0.10/32"
+	if out := strings.Join(l, " "); out != exp {
+		t.Errorf("want: [%s]\nget: [%s]", exp, out)
+	}
+}
+
+func TestLoadDump(t *testing.T) {
+	ta := NewTable()
+	for _, in := range []string{
+		"1.0.0.4/30", "1.0.0.8/30", "10.0.0.0/8", "0.0.0.0/32",
+	} {
+		_, cidr, _ := net.ParseCIDR(in)
+		ta.Add(NewRecordFromCIDR(cidr, ps("A "+in)), false)
+	}
+	for in, v := range map[string]ps{
+		"1.0.0.5/32":  "(B)",
+		"1.0.0.6/32":  "C\n\"D",
+		"1.0.0.7/32":  "E) [F]",
+		"1.0.0.12/32": "\"G\"",
+	} {
+		_, cidr, _ := net.ParseCIDR(in)
+		ta.Add(NewRecordFromCIDR(cidr, v), true)
+	}
+
+	dump := ta.Dump()
+	if !strings.Contains(dump, `1.0.0.6/32 ("C\n\"D")`) {
+		t.Errorf("get: [%s]", dump)
+	}
+	decode := func(s string) (Payload, error) { return ps(s), nil }
+	lt, err := Load(strings.NewReader(dump+"\n\n"), decode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := lt.Dump(); out != dump {
+		t.Errorf("want: [%s]\nget: [%s]", dump, out)
+	}
+
+	// an aggregated tree may end up with a single leaf for everything
+	ta = NewTable()
+	for in, v := range map[string]ps{"0.0.0.0/1": "A", "128.0.0.0/2": "B", "192.0.0.0/2": "A"} {
+		_, cidr, _ := net.ParseCIDR(in)
+		ta.Add(NewRecordFromCIDR(cidr, v), false)
+	}
+	ta.Aggregate(1)
+	dump = ta.Dump()
+	if lt, err = Load(strings.NewReader(dump), decode); err != nil {
+		t.Fatal(err)
+	}
+	if out := lt.Dump(); out != dump || out != "0.0.0.0/0 (A)" {
+		t.Errorf("want: [%s]\nget: [%s]", dump, out)
+	}
+
+	for _, in := range []string{
+		"1.0.0.0/30", "1.0.0.0/30 A", "1.0.0.1/30 (A)", "1.0.0.0/30 (A",
+		"1.0.0.0/30 (\"A)", "1.0.0.0/30 (A) x", "1.0.0.0/30 (A) [x",
+	} {
+		if _, err := Load(strings.NewReader(in), decode); err == nil {
+			t.Errorf("in:[%s], want error", in)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+// Package reload keeps a geoip table in sync with its database file.
+//
+// The file is loaded in the background when its modification time or
+// size changes, or on explicit Reload. A newly loaded table replaces
+// the current one only if it passes validation, readers never see a
+// partially loaded table.
+//
+// Basic usage:
+//  1. create a loader: l := reload.New(path, reload.Binary)
+//  2. load it the first time: l.Reload()
+//  3. watch changes in background: l.Start(time.Minute)
+//  4. use the current table: l.Tree().Lookup(ip)
+package reload
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xofyarg/goutil/geoip"
+	"github.com/xofyarg/goutil/log"
+)
+
+var (
+	ErrTooFewRecords = errors.New("too few records")
+	ErrInterval      = errors.New("interval must be positive")
+)
+
+// Format reads a database file into a table.
+type Format func(r io.Reader) (*geoip.Tree, error)
+
+// Binary reads the format written by geoip.Tree.Save.
+func Binary(r io.Reader) (*geoip.Tree, error) {
+	return geoip.LoadBinary(r)
+}
+
+// JSON reads the format written by geoip.Tree.MarshalJSON.
+func JSON(r io.Reader) (*geoip.Tree, error) {
+	t := geoip.NewTable()
+	if err := json.NewDecoder(r).Decode(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Text returns a Format reading the output of geoip.Tree.Dump, with
+// payloads converted by decode.
+func Text(decode func(string) (geoip.Payload, error)) Format {
+	return func(r io.Reader) (*geoip.Tree, error) {
+		return geoip.Load(r, decode)
+	}
+}
+
+// Status describes the last load attempt.
+type Status struct {
+	Attempt time.Time // time of the last attempt
+	Loaded  time.Time // time the current table was loaded
+	ModTime time.Time // modification time of the loaded file
+	Records int       // number of records of the current table
+	Err     error     // error of the last attempt, nil on success
+}
+
+// Loader owns a database file and the table loaded from it.
+type Loader struct {
+	// MinRecords is the minimal number of records a table must have.
+	MinRecords int
+	// Validate, if not nil, checks a newly loaded table before use.
+	Validate func(t *geoip.Tree) error
+
+	path   string
+	format Format
+
+	tree    atomic.Pointer[geoip.Tree]
+	loading sync.Mutex // serializes loads
+
+	mu     sync.Mutex // protects fields below, never held during a load
+	status Status
+	mod    time.Time // state of the file of the last attempt
+	size   int64
+	sum    [sha256.Size]byte
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// New creates a loader of the file at path in the given format. No
+// table is available before the first load.
+func New(path string, format Format) *Loader {
+	return &Loader{
+		path:   path,
+		format: format,
+	}
+}
+
+// Tree returns the current table, nil if never loaded.
+func (l *Loader) Tree() *geoip.Tree {
+	return l.tree.Load()
+}
+
+// Status returns the result of the last load attempt.
+func (l *Loader) Status() Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.status
+}
+
+// Reload loads the file unconditionally. The current table is kept on
+// failure.
+func (l *Loader) Reload() error {
+	l.loading.Lock()
+	defer l.loading.Unlock()
+	return l.load(true)
+}
+
+// Start watches the file every interval in background, reloading it
+// when changed. It does nothing if already started.
+func (l *Loader) Start(interval time.Duration) error {
+	if interval <= 0 {
+		return ErrInterval
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.stop != nil {
+		return nil
+	}
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+
+	go func(stop, done chan struct{}) {
+		defer close(done)
+
+		tk := time.NewTicker(interval)
+		defer tk.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-tk.C:
+				l.check()
+			}
+		}
+	}(l.stop, l.done)
+	return nil
+}
+
+// Stop stops watching the file and waits for the pending load.
+func (l *Loader) Stop() {
+	l.mu.Lock()
+	stop, done := l.stop, l.done
+	l.stop, l.done = nil, nil
+	l.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// check reloads the file if it changed since the last load.
+func (l *Loader) check() {
+	l.loading.Lock()
+	defer l.loading.Unlock()
+
+	fi, err := os.Stat(l.path)
+	if err != nil {
+		l.fail(err)
+		return
+	}
+	l.mu.Lock()
+	same := fi.ModTime().Equal(l.mod) && fi.Size() == l.size
+	l.mu.Unlock()
+	if same {
+		return
+	}
+
+	l.load(false)
+}
+
+// load reads the file and swaps the table in, the same content is not
+// parsed again unless force. Must be called with l.loading held.
+func (l *Loader) load(force bool) error {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return l.fail(err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return l.fail(err)
+	}
+	l.mu.Lock()
+	l.mod = fi.ModTime()
+	l.size = fi.Size()
+	last := l.sum
+	l.mu.Unlock()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return l.fail(err)
+	}
+
+	sum := sha256.Sum256(data)
+	if !force && l.tree.Load() != nil && sum == last {
+		// touched but not changed
+		l.mu.Lock()
+		l.status.Attempt = time.Now()
+		l.status.ModTime = fi.ModTime()
+		l.status.Err = nil
+		l.mu.Unlock()
+		return nil
+	}
+
+	t, err := l.format(bytes.NewReader(data))
+	if err != nil {
+		return l.fail(err)
+	}
+	n := t.Len()
+	if n < l.MinRecords {
+		return l.fail(fmt.Errorf("%d < %d: %w", n, l.MinRecords, ErrTooFewRecords))
+	}
+	if l.Validate != nil {
+		if err := l.Validate(t); err != nil {
+			return l.fail(err)
+		}
+	}
+
+	l.tree.Store(t)
+	now := time.Now()
+	l.mu.Lock()
+	l.status = Status{
+		Attempt: now,
+		Loaded:  now,
+		ModTime: fi.ModTime(),
+		Records: n,
+	}
+	l.sum = sum
+	l.mu.Unlock()
+	log.Infof("geoip: loaded %d records from %s", n, l.path)
+	return nil
+}
+
+// fail records a failed attempt, the error is logged only if it
+// differs from the last one, e.g. not every tick while the file is
+// missing. Must be called with l.loading held.
+func (l *Loader) fail(err error) error {
+	l.mu.Lock()
+	changed := l.status.Err == nil || l.status.Err.Error() != err.Error()
+	l.status.Attempt = time.Now()
+	l.status.Err = err
+	l.mu.Unlock()
+
+	if changed {
+		log.Warnf("geoip: failed to load %s: %v", l.path, err)
+	}
+	return err
+}
@@ -0,0 +1,176 @@
+package reload
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xofyarg/goutil/geoip"
+)
+
+type ps string
+
+func (p ps) Equal(t geoip.Payload) bool {
+	s, ok := t.(ps)
+	return ok && p == s
+}
+
+func (p ps) String() string {
+	return string(p)
+}
+
+var text = Text(func(s string) (geoip.Payload, error) {
+	return ps(s), nil
+})
+
+func write(t *testing.T, path, data string, mod time.Time) {
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func lookup(l *Loader, ip string) geoip.Payload {
+	v, _ := l.Tree().Lookup(net.ParseIP(ip))
+	return v
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.txt")
+	now := time.Now()
+	write(t, path, "1.0.0.0/24 (A)\n2.0.0.0/24 (B)\n", now)
+
+	l := New(path, text)
+	l.MinRecords = 2
+	if l.Tree() != nil {
+		t.Fatal("want no tree before load")
+	}
+	if err := l.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if v := lookup(l, "1.0.0.1"); v != ps("A") {
+		t.Errorf("want: A, get: %v", v)
+	}
+	if st := l.Status(); st.Records != 2 || st.Err != nil {
+		t.Errorf("get status: %+v", st)
+	}
+
+	// invalid content keeps the old tree
+	write(t, path, "1.0.0.0/24 (C)\n", now.Add(time.Second))
+	if err := l.Reload(); !errors.Is(err, ErrTooFewRecords) {
+		t.Errorf("want: %v, get: %v", ErrTooFewRecords, err)
+	}
+	if v := lookup(l, "1.0.0.1"); v != ps("A") {
+		t.Errorf("want: A, get: %v", v)
+	}
+	if st := l.Status(); st.Err == nil || st.Records != 2 {
+		t.Errorf("get status: %+v", st)
+	}
+
+	// changes are picked up by check
+	write(t, path, "1.0.0.0/24 (C)\n2.0.0.0/24 (D)\n", now.Add(2*time.Second))
+	l.check()
+	if v := lookup(l, "1.0.0.1"); v != ps("C") {
+		t.Errorf("want: C, get: %v", v)
+	}
+
+	l.Validate = func(*geoip.Tree) error { return errors.New("bad") }
+	write(t, path, "1.0.0.0/24 (E)\n2.0.0.0/24 (D)\n", now.Add(3*time.Second))
+	l.check()
+	if v := lookup(l, "1.0.0.1"); v != ps("C") {
+		t.Errorf("want: C, get: %v", v)
+	}
+}
+
+func TestStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.txt")
+	now := time.Now()
+	write(t, path, "1.0.0.0/24 (A)\n", now)
+
+	l := New(path, text)
+	if err := l.Start(0); !errors.Is(err, ErrInterval) {
+		t.Errorf("want: %v, get: %v", ErrInterval, err)
+	}
+	if err := l.Start(10 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Stop()
+
+	write(t, path, "1.0.0.0/24 (B)\n", now.Add(time.Second))
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if l.Tree() != nil && lookup(l, "1.0.0.1") == ps("B") {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("change not loaded")
+}
+
+func TestFailLogged(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	path := filepath.Join(t.TempDir(), "db.txt")
+	l := New(path, text)
+	for i := 0; i < 3; i++ {
+		l.check()
+	}
+	if n := bytes.Count(buf.Bytes(), []byte("failed to load")); n != 1 {
+		t.Errorf("want: 1 warning while missing, get: %d\n%s", n, buf.String())
+	}
+
+	// logged again after recovered
+	write(t, path, "1.0.0.0/24 (A)\n", time.Now())
+	l.check()
+	os.Remove(path)
+	l.check()
+	l.check()
+	if n := bytes.Count(buf.Bytes(), []byte("failed to load")); n != 2 {
+		t.Errorf("want: 2 warnings, get: %d\n%s", n, buf.String())
+	}
+}
+
+func TestStatusDuringLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.txt")
+	write(t, path, "1.0.0.0/24 (A)\n", time.Now())
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	l := New(path, func(r io.Reader) (*geoip.Tree, error) {
+		close(entered)
+		<-release
+		return text(r)
+	})
+	errc := make(chan error)
+	go func() { errc <- l.Reload() }()
+	<-entered
+
+	got := make(chan Status)
+	go func() { got <- l.Status() }()
+	select {
+	case s := <-got:
+		if !s.Loaded.IsZero() {
+			t.Errorf("want nothing loaded yet, get: %+v", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Status blocked by a pending load")
+	}
+
+	close(release)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if s := l.Status(); s.Records != 1 {
+		t.Errorf("want: 1 record, get: %+v", s)
+	}
+}
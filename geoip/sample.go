@@ -0,0 +1,192 @@
+package geoip
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sort"
+)
+
+var ErrSynthetic = errors.New("cannot synthesize tree")
+
+// maximal number of successive prefixes Synthesize fails to place
+const maxMisses = 10000
+
+// records is a list of records with the cumulative number of
+// addresses covered, for weighted picking.
+type records[T any] struct {
+	rs  []*RecordOf[T]
+	cum []uint64
+}
+
+func (l *records[T]) add(r *RecordOf[T]) {
+	var total uint64
+	if n := len(l.cum); n > 0 {
+		total = l.cum[n-1]
+	}
+	l.rs = append(l.rs, r)
+	l.cum = append(l.cum, total+uint64(1)<<uint(32-r.i.size))
+}
+
+// pick returns an address uniformly in the records.
+func (l *records[T]) pick(rnd *rand.Rand) net.IP {
+	n := uint64(rnd.Int63n(int64(l.cum[len(l.cum)-1])))
+	i := sort.Search(len(l.cum), func(i int) bool { return l.cum[i] > n })
+	if i > 0 {
+		n -= l.cum[i-1]
+	}
+	return numToIP(l.rs[i].i.prefix + uint32(n))
+}
+
+// SamplerOf draws random addresses covered by a tree. The records are
+// taken when created, later changes of the tree are not seen. A
+// sampler is not safe for concurrent use, as the rand.Rand it uses.
+type SamplerOf[T any] struct {
+	rnd    *rand.Rand
+	all    records[T]
+	values []records[T] // grouped by equal values
+}
+
+// Sampler is a SamplerOf trees of Payload.
+type Sampler = SamplerOf[Payload]
+
+// NewSamplerOf creates a sampler of the records of t, drawing random
+// numbers from rnd.
+func NewSamplerOf[T any](t *TreeOf[T], rnd *rand.Rand) *SamplerOf[T] {
+	s := &SamplerOf[T]{rnd: rnd}
+	groups := make(map[any][]int)
+
+	t.walk(func(r *RecordOf[T], ud interface{}) {
+		s.all.add(r)
+
+		k := t.key(r.v)
+		for _, i := range groups[k] {
+			if t.equal(s.values[i].rs[0].v, r.v) {
+				s.values[i].add(r)
+				return
+			}
+		}
+		groups[k] = append(groups[k], len(s.values))
+		s.values = append(s.values, records[T]{})
+		s.values[len(s.values)-1].add(r)
+	}, nil)
+	return s
+}
+
+// NewSampler creates a sampler of the records of t. See NewSamplerOf.
+func NewSampler(t *Tree, rnd *rand.Rand) *Sampler {
+	return NewSamplerOf(&t.t, rnd)
+}
+
+// Address returns an address drawn uniformly from the address space
+// covered by the tree, so larger prefixes are drawn more often. It
+// returns nil if the tree is empty.
+func (s *SamplerOf[T]) Address() net.IP {
+	if len(s.all.rs) == 0 {
+		return nil
+	}
+	return s.all.pick(s.rnd)
+}
+
+// AddressPerValue returns an address of a value drawn uniformly from
+// the distinct values of the tree, so rare values are drawn as often
+// as common ones. It returns nil if the tree is empty.
+func (s *SamplerOf[T]) AddressPerValue() net.IP {
+	if len(s.values) == 0 {
+		return nil
+	}
+	return s.values[s.rnd.Intn(len(s.values))].pick(s.rnd)
+}
+
+// Synthesize adds n random non-overlapping prefixes into the empty
+// tree t, from /8 to /24 with each size covering about the same
+// address space. Values are drawn from vals with the relative
+// weights, or uniformly if weights is nil. No records are merged, so
+// t ends with exactly n records.
+func Synthesize[T any](t *TreeOf[T], rnd *rand.Rand, n int, vals []T, weights []float64) error {
+	switch {
+	case t.Len() != 0:
+		return errors.New("geoip: synthesize into non-empty tree")
+	case len(vals) == 0:
+		return errors.New("geoip: synthesize without values")
+	case weights != nil && len(weights) != len(vals):
+		return errors.New("geoip: number of weights and values differ")
+	}
+
+	cum := make([]float64, len(vals))
+	var total float64
+	for i := range vals {
+		w := 1.0
+		if weights != nil {
+			w = weights[i]
+		}
+		total += w
+		cum[i] = total
+	}
+
+	// give up when the space left is too fragmented
+	for added, misses := 0, 0; added < n; {
+		if misses > maxMisses {
+			return ErrSynthetic
+		}
+
+		// a /24 half of the time, a /23 a quarter, and so on
+		size := 24
+		for size > 8 && rnd.Intn(2) == 0 {
+			size--
+		}
+		c := cidr{prefix: rnd.Uint32() & sizeToMask(size), size: size}
+
+		x := rnd.Float64() * total
+		v := vals[sort.SearchFloat64s(cum, x)%len(vals)]
+		if !t.vacant(c, v) {
+			misses++
+			continue
+		}
+		t.Add(&RecordOf[T]{i: c, v: v}, false)
+		added++
+		misses = 0
+	}
+	return nil
+}
+
+// vacant reports whether c overlaps no record of t, and has no
+// sibling with the value v it would be merged with.
+func (t *TreeOf[T]) vacant(c cidr, v T) bool {
+	if len(t.nodes) == 0 {
+		return true
+	}
+
+	prefix := c.prefix
+	n := &t.nodes[0]
+	for depth := 1; depth <= c.size; depth++ {
+		if n.leaf {
+			return false
+		}
+		tb := prefix >> 31
+		prefix <<= 1
+
+		if depth == c.size {
+			if n.c[tb] != 0 {
+				return false
+			}
+			s := n.c[1-tb]
+			return s == 0 || !t.nodes[s].leaf || !t.equal(t.vals[t.nodes[s].v], v)
+		}
+		if n.c[tb] == 0 {
+			return true
+		}
+		n = &t.nodes[n.c[tb]]
+	}
+	return !n.leaf && n.c == [2]uint32{}
+}
+
+// Synthetic creates a tree of n random non-overlapping prefixes with
+// payloads drawn from vals. See Synthesize.
+func Synthetic(rnd *rand.Rand, n int, vals []Payload, weights []float64) (*Tree, error) {
+	t := NewTable()
+	if err := Synthesize(&t.t, rnd, n, vals, weights); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
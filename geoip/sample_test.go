@@ -0,0 +1,64 @@
+package geoip
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSampler(t *testing.T) {
+	ta := NewTable()
+	ta.Add(rec("10.0.0.0/8", "A"), false)
+	ta.Add(rec("1.2.3.4/32", "B"), false)
+	ta.Add(rec("1.2.3.6/31", "B"), false)
+
+	s := NewSampler(ta, rand.New(rand.NewSource(1)))
+	count := func(f func() (Payload, bool)) map[Payload]int {
+		m := make(map[Payload]int)
+		for i := 0; i < 1000; i++ {
+			v, ok := f()
+			if !ok {
+				t.Fatalf("sampled address not covered")
+			}
+			m[v]++
+		}
+		return m
+	}
+
+	m := count(func() (Payload, bool) { return ta.Lookup(s.Address()) })
+	if m[ps("A")] != 1000 {
+		t.Errorf("by address, want: all A, get: %v", m)
+	}
+	m = count(func() (Payload, bool) { return ta.Lookup(s.AddressPerValue()) })
+	if m[ps("B")] < 400 || m[ps("B")] > 600 {
+		t.Errorf("per value, want: about 500 B, get: %v", m)
+	}
+
+	if ip := NewSampler(NewTable(), rand.New(rand.NewSource(1))).Address(); ip != nil {
+		t.Errorf("want: nil, get:[%s]", ip)
+	}
+}
+
+func TestSynthetic(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	vals := []Payload{ps("A"), ps("B"), ps("C")}
+	ta, err := Synthetic(rnd, 3000, vals, []float64{8, 1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ta.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if n := ta.Len(); n != 3000 {
+		t.Errorf("want: 3000 records, get: %d", n)
+	}
+
+	m := make(map[Payload]int)
+	ta.walk(func(r *Record, ud interface{}) { m[r.v]++ }, nil)
+	if m[ps("A")] < 2200 || m[ps("B")] < 150 || m[ps("C")] < 150 {
+		t.Errorf("want: about 2400/300/300, get: %v", m)
+	}
+
+	if _, err := Synthetic(rnd, 300, vals, []float64{1}); err == nil {
+		t.Errorf("want: error on weights mismatch")
+	}
+}
@@ -0,0 +1,249 @@
+// Package server exposes a geoip table over HTTP, so services not
+// written in Go can share the same lookup implementation.
+//
+// Endpoints:
+//
+//	GET  /lookup?ip=1.2.3.4   look up one address
+//	POST /lookup              look up a JSON array of addresses
+//	GET  /stats               statistics of the table
+//	POST /admin/reload        reload the table, if supported
+//
+// Admin endpoints are disabled unless AdminToken is set, and require
+// it as a bearer token.
+//
+// Results are JSON objects with the address, the prefix it belongs
+// to, the payload and its source. Payloads implementing
+// geoip.Marshaler are encoded with MarshalJSON, others as their
+// string form.
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/xofyarg/goutil/geoip"
+	"github.com/xofyarg/goutil/geoip/reload"
+)
+
+const (
+	// MaxBatch is the maximal number of addresses in a batch lookup.
+	MaxBatch = 10000
+	// maximal size of request body
+	maxBody = 1 << 20
+)
+
+var errNoTree = errors.New("no table loaded")
+
+// Result is the answer of a lookup.
+type Result struct {
+	IP      string          `json:"ip"`
+	Found   bool            `json:"found"`
+	Prefix  string          `json:"prefix,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Source  string          `json:"source,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// Server is an http.Handler answering lookups from a table.
+type Server struct {
+	// AdminToken is required as a bearer token by the admin
+	// endpoints, which are disabled if empty.
+	AdminToken string
+
+	tree   func() *geoip.Tree
+	reload func() error
+	status func() interface{}
+	mux    *http.ServeMux
+}
+
+// New creates a server using the table returned by tree. reload is
+// called by the admin reload endpoint, which is disabled if nil.
+func New(tree func() *geoip.Tree, reload func() error) *Server {
+	s := &Server{
+		tree:   tree,
+		reload: reload,
+		mux:    http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("/lookup", methods(map[string]http.HandlerFunc{
+		http.MethodGet:  s.lookup,
+		http.MethodPost: s.batch,
+	}))
+	s.mux.HandleFunc("/stats", methods(map[string]http.HandlerFunc{
+		http.MethodGet: s.stats,
+	}))
+	s.mux.HandleFunc("/admin/reload", methods(map[string]http.HandlerFunc{
+		http.MethodPost: s.doReload,
+	}))
+	return s
+}
+
+// methods dispatches requests by method.
+func methods(hs map[string]http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h, ok := hs[r.Method]
+		if !ok {
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		h(w, r)
+	}
+}
+
+// NewFromLoader creates a server using the table of l, the load
+// status is reported in stats.
+func NewFromLoader(l *reload.Loader) *Server {
+	s := New(l.Tree, l.Reload)
+	s.status = func() interface{} {
+		st := l.Status()
+		var msg string
+		if st.Err != nil {
+			msg = st.Err.Error()
+		}
+		return struct {
+			reload.Status
+			Err string `json:"Err,omitempty"`
+		}{st, msg}
+	}
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) {
+	t := s.tree()
+	if t == nil {
+		writeError(w, http.StatusServiceUnavailable, errNoTree)
+		return
+	}
+
+	res := find(t, r.URL.Query().Get("ip"))
+	code := http.StatusOK
+	if res.Error != "" {
+		code = http.StatusBadRequest
+	}
+	writeJSON(w, code, res)
+}
+
+func (s *Server) batch(w http.ResponseWriter, r *http.Request) {
+	t := s.tree()
+	if t == nil {
+		writeError(w, http.StatusServiceUnavailable, errNoTree)
+		return
+	}
+
+	var ips []string
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBody))
+	if err := dec.Decode(&ips); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(ips) > MaxBatch {
+		writeError(w, http.StatusRequestEntityTooLarge, errors.New("too many addresses"))
+		return
+	}
+
+	rs := make([]Result, len(ips))
+	for i, ip := range ips {
+		rs[i] = find(t, ip)
+	}
+	writeJSON(w, http.StatusOK, rs)
+}
+
+func (s *Server) stats(w http.ResponseWriter, r *http.Request) {
+	var resp struct {
+		Tree   *geoip.Stats `json:"tree,omitempty"`
+		Status interface{}  `json:"status,omitempty"`
+	}
+
+	if t := s.tree(); t != nil {
+		st := t.Stats()
+		resp.Tree = &st
+	}
+	if s.status != nil {
+		resp.Status = s.status()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) doReload(w http.ResponseWriter, r *http.Request) {
+	if !s.admin(w, r) {
+		return
+	}
+	if s.reload == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("reload not supported"))
+		return
+	}
+
+	if err := s.reload(); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	s.stats(w, r)
+}
+
+// admin checks the token of an admin request, and writes the error
+// if rejected.
+func (s *Server) admin(w http.ResponseWriter, r *http.Request) bool {
+	if s.AdminToken == "" {
+		writeError(w, http.StatusForbidden, errors.New("admin endpoints disabled"))
+		return false
+	}
+	auth := r.Header.Get("Authorization")
+	if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+s.AdminToken)) != 1 {
+		writeError(w, http.StatusForbidden, errors.New("forbidden"))
+		return false
+	}
+	return true
+}
+
+// find looks up ip in t.
+func find(t *geoip.Tree, ip string) Result {
+	res := Result{IP: ip}
+	addr := net.ParseIP(ip)
+	if addr == nil || addr.To4() == nil {
+		res.Error = "invalid IPv4 address"
+		return res
+	}
+
+	rec, ok := t.LookupRecord(addr)
+	if !ok {
+		return res
+	}
+
+	res.Found = true
+	res.Prefix = rec.Prefix().String()
+	if src := rec.Source(); src != nil {
+		res.Source = src.Name
+	}
+	if v := rec.Payload(); v != nil {
+		var err error
+		if m, ok := v.(geoip.Marshaler); ok {
+			res.Payload, err = m.MarshalJSON()
+		} else {
+			res.Payload, err = json.Marshal(v.String())
+		}
+		if err != nil {
+			res.Error = err.Error()
+		}
+	}
+	return res
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/xofyarg/goutil/geoip"
+	"github.com/xofyarg/goutil/geoip/special"
+)
+
+func newServer() (*Server, *int) {
+	t := special.NewTable()
+	_, cidr, _ := net.ParseCIDR("8.8.8.0/24")
+	t.AddFrom(geoip.NewRecordFromCIDR(cidr, special.Reserved), &geoip.Source{Name: "test"})
+
+	n := 0
+	reload := func() error {
+		n++
+		if n > 1 {
+			return errors.New("broken")
+		}
+		return nil
+	}
+	return New(func() *geoip.Tree { return t }, reload), &n
+}
+
+func do(t *testing.T, h http.Handler, method, url, body string, v interface{}) int {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %v: %s", method, url, err, w.Body)
+		}
+	}
+	return w.Code
+}
+
+func TestLookup(t *testing.T) {
+	s, _ := newServer()
+
+	var r Result
+	if code := do(t, s, "GET", "/lookup?ip=10.1.2.3", "", &r); code != http.StatusOK {
+		t.Errorf("get code: %d", code)
+	}
+	if !r.Found || r.Prefix != "10.0.0.0/8" || string(r.Payload) != `"private"` {
+		t.Errorf("get: %+v", r)
+	}
+
+	r = Result{}
+	do(t, s, "GET", "/lookup?ip=8.8.8.8", "", &r)
+	if !r.Found || r.Source != "test" || string(r.Payload) != `"reserved"` {
+		t.Errorf("get: %+v", r)
+	}
+
+	r = Result{}
+	do(t, s, "GET", "/lookup?ip=1.1.1.1", "", &r)
+	if r.Found || r.Error != "" {
+		t.Errorf("get: %+v", r)
+	}
+
+	if code := do(t, s, "GET", "/lookup?ip=::1", "", nil); code != http.StatusBadRequest {
+		t.Errorf("get code: %d", code)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	s, _ := newServer()
+
+	var rs []Result
+	code := do(t, s, "POST", "/lookup", `["127.0.0.1", "x", "1.1.1.1"]`, &rs)
+	if code != http.StatusOK || len(rs) != 3 {
+		t.Fatalf("get code: %d, results: %+v", code, rs)
+	}
+	if !rs[0].Found || string(rs[0].Payload) != `"loopback"` {
+		t.Errorf("get: %+v", rs[0])
+	}
+	if rs[1].Error == "" || rs[2].Found {
+		t.Errorf("get: %+v", rs[1:])
+	}
+
+	if code := do(t, s, "POST", "/lookup", `{`, nil); code != http.StatusBadRequest {
+		t.Errorf("get code: %d", code)
+	}
+}
+
+func TestStatsReload(t *testing.T) {
+	s, n := newServer()
+	if code := do(t, s, "POST", "/admin/reload", "", nil); code != http.StatusForbidden || *n != 0 {
+		t.Errorf("admin without token, get code: %d, reloads: %d", code, *n)
+	}
+	s.AdminToken = "secret"
+
+	var st struct {
+		Tree geoip.Stats `json:"tree"`
+	}
+	do(t, s, "GET", "/stats", "", &st)
+	if st.Tree.Records == 0 || st.Tree.Sources != 1 {
+		t.Errorf("get: %+v", st)
+	}
+
+	if code := do(t, s, "POST", "/admin/reload", "", nil); code != http.StatusForbidden {
+		t.Errorf("get code: %d", code)
+	}
+	bad := httptest.NewRequest("POST", "/admin/reload", nil)
+	bad.Header.Set("Authorization", "Bearer secreT")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, bad)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("get code: %d", w.Code)
+	}
+
+	req := httptest.NewRequest("POST", "/admin/reload", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || *n != 1 {
+		t.Errorf("get code: %d, reloads: %d", w.Code, *n)
+	}
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("get code: %d", w.Code)
+	}
+}
@@ -0,0 +1,80 @@
+package geoip
+
+// Source describes where records come from when merging databases of
+// different vendors. Sources are identified by pointer.
+type Source struct {
+	Name string
+	// records from a source with higher priority replace the
+	// overlapped ones from lower priority sources
+	Priority int
+}
+
+func (s *Source) priority() int {
+	if s == nil {
+		return 0
+	}
+	return s.Priority
+}
+
+// source returns the index of src in the source table, 0 is reserved
+// for records added without source.
+func (t *TreeOf[T]) source(src *Source) uint16 {
+	if src == nil {
+		return 0
+	}
+	if t.sidx == nil {
+		t.srcs = []*Source{nil}
+		t.sidx = make(map[*Source]uint16)
+	}
+
+	if i, ok := t.sidx[src]; ok {
+		return i
+	}
+	if len(t.srcs) > 1<<16-1 {
+		panic("geoip: too many sources")
+	}
+
+	i := uint16(len(t.srcs))
+	t.srcs = append(t.srcs, src)
+	t.sidx[src] = i
+	return i
+}
+
+// known returns the source of t with the same name and priority as
+// src, or src if there is none. Sources read back from persisted
+// forms are matched by it to the ones already in the tree.
+func (t *TreeOf[T]) known(src *Source) *Source {
+	if src == nil {
+		return nil
+	}
+	if _, ok := t.sidx[src]; ok {
+		return src
+	}
+	for _, s := range t.srcs {
+		if s != nil && *s == *src {
+			return s
+		}
+	}
+	return src
+}
+
+// sourceOf returns the source of a leaf.
+func (t *TreeOf[T]) sourceOf(n *node) *Source {
+	if n.s == 0 {
+		return nil
+	}
+	return t.srcs[n.s]
+}
+
+// AddFrom append a record coming from src to the tree. On the
+// overlapped part, the record replaces the existing ones with lower
+// source priority, and is dropped otherwise. Records added by Add
+// have priority 0. The source of each leaf is kept, see LookupRecord
+// and Dump.
+func (t *TreeOf[T]) AddFrom(r *RecordOf[T], src *Source) {
+	p := src.priority()
+	wins := func(n *node) bool {
+		return p > t.sourceOf(n).priority()
+	}
+	t.add(r, t.source(src), wins, false)
+}
@@ -0,0 +1,98 @@
+package geoip
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestAddFrom(t *testing.T) {
+	low := &Source{Name: "low", Priority: 1}
+	high := &Source{Name: "high", Priority: 2}
+
+	ta := NewTable()
+	for _, in := range []struct {
+		cidr string
+		v    ps
+		src  *Source
+	}{
+		{"1.0.0.0/30", "A", low},
+		{"1.0.0.4/30", "B", high},
+		{"1.0.0.0/29", "C", high},
+		{"1.0.0.0/28", "D", low},
+		{"1.0.0.12/30", "E", nil},
+	} {
+		_, cidr, _ := net.ParseCIDR(in.cidr)
+		ta.AddFrom(NewRecordFromCIDR(cidr, in.v), in.src)
+	}
+
+	exp := "1.0.0.0/30 (C) [high]\n1.0.0.4/30 (B) [high]\n1.0.0.8/29 (D) [low]"
+	if out := ta.Dump(); out != exp {
+		t.Errorf("want: [%s]\nget: [%s]", exp, out)
+	}
+
+	r, ok := ta.LookupRecord(net.ParseIP("1.0.0.9"))
+	if !ok || r.Source() != low || r.Payload() != ps("D") ||
+		r.Prefix().String() != "1.0.0.8/29" {
+		t.Errorf("get: [%v]", r)
+	}
+
+	lt, err := Load(strings.NewReader(exp), func(s string) (Payload, error) {
+		return ps(s), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := lt.Dump(); out != exp {
+		t.Errorf("want: [%s]\nget: [%s]", exp, out)
+	}
+
+	exp = `1.0.0.0/8 (A) ["x] [y"]`
+	lt, err = Load(strings.NewReader(exp), func(s string) (Payload, error) {
+		return ps(s), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := lt.LookupRecord(net.ParseIP("1.0.0.1")); r == nil || r.Source().Name != "x] [y" {
+		t.Errorf("get: [%v]", r)
+	}
+	if out := lt.Dump(); out != exp {
+		t.Errorf("want: [%s]\nget: [%s]", exp, out)
+	}
+}
+
+func TestAddFromSameValue(t *testing.T) {
+	a := &Source{Name: "a", Priority: 1}
+	b := &Source{Name: "b", Priority: 1}
+
+	ta := NewTable()
+	for _, in := range []struct {
+		cidr string
+		src  *Source
+	}{
+		{"1.0.0.0/25", a},
+		{"1.0.0.128/25", b},
+		{"1.0.0.0/24", a},
+	} {
+		_, cidr, _ := net.ParseCIDR(in.cidr)
+		ta.AddFrom(NewRecordFromCIDR(cidr, ps("A")), in.src)
+	}
+
+	exp := "1.0.0.0/25 (A) [a]\n1.0.0.128/25 (A) [b]"
+	if out := ta.Dump(); out != exp {
+		t.Errorf("want: [%s]\nget: [%s]", exp, out)
+	}
+}
+
+func TestAddKeep(t *testing.T) {
+	doAddTest(t,
+		acase{
+			[]input{
+				{"1.0.0.0/30", "A", false},
+				{"1.0.0.0/30", "B", false},
+			},
+			"1.0.0.0/30 (A)",
+		},
+	)
+}
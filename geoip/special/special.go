@@ -0,0 +1,178 @@
+// Package special provides geoip tables for the IANA IPv4
+// special-purpose address registry and other non-routable (bogon)
+// blocks, used to label such traffic consistently in merged
+// databases.
+//
+// Basic usage:
+//  1. build a standalone table: special.NewTable(special.Private, ...)
+//  2. or label an existing table: special.Overlay(table)
+//  3. check the payload returned by Lookup: v.(special.Kind)
+package special
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/xofyarg/goutil/geoip"
+)
+
+// Kind is the payload of special-purpose address blocks.
+type Kind uint8
+
+const (
+	// ThisNetwork is "this host on this network", RFC 1122.
+	ThisNetwork Kind = iota + 1
+	// Private is private-use space, RFC 1918.
+	Private
+	// Shared is shared address space used for CGNAT, RFC 6598.
+	Shared
+	// Loopback is the loopback block, RFC 1122.
+	Loopback
+	// LinkLocal is the link local block, RFC 3927.
+	LinkLocal
+	// Protocol is IETF protocol assignments, RFC 6890.
+	Protocol
+	// Documentation is TEST-NET-1/2/3, RFC 5737.
+	Documentation
+	// Benchmarking is network device benchmarking, RFC 2544.
+	Benchmarking
+	// Multicast is the multicast block, RFC 5771.
+	Multicast
+	// Reserved is reserved or deprecated space, RFC 1112, RFC 7526.
+	Reserved
+	// Broadcast is the limited broadcast address, RFC 919.
+	Broadcast
+)
+
+var kindStr = map[Kind]string{
+	ThisNetwork:   "this-network",
+	Private:       "private",
+	Shared:        "shared",
+	Loopback:      "loopback",
+	LinkLocal:     "link-local",
+	Protocol:      "protocol",
+	Documentation: "documentation",
+	Benchmarking:  "benchmarking",
+	Multicast:     "multicast",
+	Reserved:      "reserved",
+	Broadcast:     "broadcast",
+}
+
+// Equal implements geoip.Payload.
+func (k Kind) Equal(p geoip.Payload) bool {
+	o, ok := p.(Kind)
+	return ok && o == k
+}
+
+// String implements geoip.Payload.
+func (k Kind) String() string {
+	if s, ok := kindStr[k]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+// Tag implements geoip.Marshaler.
+func (k Kind) Tag() string {
+	return "special"
+}
+
+// MarshalBinary implements geoip.Marshaler.
+func (k Kind) MarshalBinary() ([]byte, error) {
+	return []byte{byte(k)}, nil
+}
+
+// MarshalJSON implements geoip.Marshaler.
+func (k Kind) MarshalJSON() ([]byte, error) {
+	return json.Marshal(k.String())
+}
+
+func init() {
+	geoip.Register(Kind(0).Tag(), geoip.Decoder{
+		Binary: func(data []byte) (geoip.Payload, error) {
+			if len(data) != 1 || kindStr[Kind(data[0])] == "" {
+				return nil, fmt.Errorf("special: invalid kind %v", data)
+			}
+			return Kind(data[0]), nil
+		},
+		JSON: func(data []byte) (geoip.Payload, error) {
+			var s string
+			if err := json.Unmarshal(data, &s); err != nil {
+				return nil, err
+			}
+			for k, v := range kindStr {
+				if v == s {
+					return k, nil
+				}
+			}
+			return nil, fmt.Errorf("special: invalid kind %q", s)
+		},
+	})
+}
+
+// block is an entry of the registry.
+type block struct {
+	cidr string
+	kind Kind
+}
+
+// registry in insertion order, more specific blocks come after the
+// ones covering them.
+var registry = []block{
+	{"0.0.0.0/8", ThisNetwork},
+	{"10.0.0.0/8", Private},
+	{"100.64.0.0/10", Shared},
+	{"127.0.0.0/8", Loopback},
+	{"169.254.0.0/16", LinkLocal},
+	{"172.16.0.0/12", Private},
+	{"192.0.0.0/24", Protocol},
+	{"192.0.2.0/24", Documentation},
+	{"192.88.99.0/24", Reserved},
+	{"192.168.0.0/16", Private},
+	{"198.18.0.0/15", Benchmarking},
+	{"198.51.100.0/24", Documentation},
+	{"203.0.113.0/24", Documentation},
+	{"224.0.0.0/4", Multicast},
+	{"240.0.0.0/4", Reserved},
+	{"255.255.255.255/32", Broadcast},
+}
+
+// Records returns the registry blocks of the given kinds as records,
+// all of them if kinds is empty. The records must be added in order
+// with overwrite set.
+func Records(kinds ...Kind) []*geoip.Record {
+	want := make(map[Kind]bool)
+	for _, k := range kinds {
+		want[k] = true
+	}
+
+	var rs []*geoip.Record
+	for _, b := range registry {
+		if len(want) != 0 && !want[b.kind] {
+			continue
+		}
+		_, n, err := net.ParseCIDR(b.cidr)
+		if err != nil {
+			panic(err)
+		}
+		rs = append(rs, geoip.NewRecordFromCIDR(n, b.kind))
+	}
+	return rs
+}
+
+// NewTable creates a table with the registry blocks of the given
+// kinds, all of them if kinds is empty.
+func NewTable(kinds ...Kind) *geoip.Tree {
+	t := geoip.NewTable()
+	Overlay(t, kinds...)
+	return t
+}
+
+// Overlay labels the registry blocks of the given kinds in t, all of
+// them if kinds is empty, replacing whatever payload t had there.
+func Overlay(t *geoip.Tree, kinds ...Kind) {
+	for _, r := range Records(kinds...) {
+		t.Add(r, true)
+	}
+}
@@ -0,0 +1,73 @@
+package special
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/xofyarg/goutil/geoip"
+)
+
+func TestLookup(t *testing.T) {
+	cases := map[string]Kind{
+		"10.1.2.3":        Private,
+		"100.127.0.1":     Shared,
+		"127.0.0.1":       Loopback,
+		"192.0.2.10":      Documentation,
+		"192.168.255.255": Private,
+		"239.1.1.1":       Multicast,
+		"250.0.0.1":       Reserved,
+		"255.255.255.255": Broadcast,
+		"8.8.8.8":         0,
+	}
+
+	ta := NewTable()
+	for ip, exp := range cases {
+		v, ok := ta.Lookup(net.ParseIP(ip))
+		if exp == 0 {
+			if ok {
+				t.Errorf("ip:[%s], want: none, get:[%s]", ip, v)
+			}
+			continue
+		}
+		if !ok || v != exp {
+			t.Errorf("ip:[%s], want:[%s], get:[%v]", ip, exp, v)
+		}
+	}
+}
+
+func TestKinds(t *testing.T) {
+	ta := NewTable(Loopback, LinkLocal)
+	exp := "127.0.0.0/8 (loopback)\n169.254.0.0/16 (link-local)"
+	if out := ta.Dump(); out != exp {
+		t.Errorf("want: [%s]\nget: [%s]", exp, out)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	ta := NewTable()
+	var buf bytes.Buffer
+	if err := ta.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lt, err := geoip.LoadBinary(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, out := ta.Dump(), lt.Dump(); want != out {
+		t.Errorf("want: [%s]\nget: [%s]", want, out)
+	}
+
+	data, err := json.Marshal(ta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lt = geoip.NewTable()
+	if err := json.Unmarshal(data, lt); err != nil {
+		t.Fatal(err)
+	}
+	if want, out := ta.Dump(), lt.Dump(); want != out {
+		t.Errorf("want: [%s]\nget: [%s]", want, out)
+	}
+}
@@ -1,98 +1,340 @@
 package geoip
 
 import (
+	"bufio"
+	"fmt"
+	"io"
 	"net"
 	"strings"
 )
 
-type node struct {
-	p, l, r *node
-	v       Payload
-	leaf    bool
+// TreeOf is a radix tree links all the records with values of type T
+// together. The zero value is an empty tree comparing values with ==,
+// or Payload.Equal if they implement Payload.
+//
+// Equal values are stored once no matter how many records refer to
+// them, the first one added is kept.
+type TreeOf[T any] struct {
+	nodes []node
+	free  []uint32
+	vals  []T
+	index map[any][]uint32
+	srcs  []*Source
+	sidx  map[*Source]uint16
+	eq    func(a, b T) bool
+	hash  func(v T) any
 }
 
-// Tree is a radix tree links all the records together.
+// NewTreeOf creates a empty radix tree comparing values with ==.
+func NewTreeOf[T comparable]() *TreeOf[T] {
+	return &TreeOf[T]{
+		eq:   func(a, b T) bool { return a == b },
+		hash: func(v T) any { return v },
+	}
+}
+
+// NewTreeFunc creates a empty radix tree comparing values with eq.
+func NewTreeFunc[T any](eq func(a, b T) bool) *TreeOf[T] {
+	return &TreeOf[T]{eq: eq}
+}
+
+// Tree is a radix tree links all the records with Payload together.
 type Tree struct {
-	root node
+	t TreeOf[Payload]
 }
 
 // NewTable creates a empty radix tree.
 func NewTable() *Tree {
-	return &Tree{}
+	return &Tree{
+		t: TreeOf[Payload]{eq: vequal},
+	}
 }
 
 // Add append a record to the tree, overwrite controls the behaivor
 // when join overlapped IP sets with different Payload. If true, the
 // latter wins.
 func (t *Tree) Add(r *Record, overwrite bool) {
+	t.t.Add(r, overwrite)
+}
+
+// Dump prints all the records inside the tree one by one.
+func (t *Tree) Dump() string {
+	return t.t.Dump()
+}
+
+// Lookup find the associated payload of an IP from the tree. It
+// returns the payload and true on success, otherwise, returns false,
+// and the payload returned is undefined.
+func (t *Tree) Lookup(ip net.IP) (Payload, bool) {
+	if t == nil {
+		return nil, false
+	}
+	return t.t.Lookup(ip)
+}
+
+// Len returns the number of records inside the tree.
+func (t *Tree) Len() int {
+	return t.t.Len()
+}
+
+// Stats returns the summary of the tree.
+func (t *Tree) Stats() Stats {
+	return t.t.Stats()
+}
+
+// LookupRecord is like Lookup, but returns the whole record the IP
+// belongs to, including the prefix and source.
+func (t *Tree) LookupRecord(ip net.IP) (*Record, bool) {
+	if t == nil {
+		return nil, false
+	}
+	return t.t.LookupRecord(ip)
+}
+
+// Delete removes all the addresses of the prefix i from the tree.
+func (t *Tree) Delete(i *net.IPNet) error {
+	return t.t.Delete(i)
+}
+
+// DeleteRecord removes the addresses of the prefix of r which are
+// associated with the payload of r.
+func (t *Tree) DeleteRecord(r *Record) {
+	t.t.DeleteRecord(r)
+}
+
+// AddFrom append a record coming from src to the tree, see
+// TreeOf.AddFrom for details.
+func (t *Tree) AddFrom(r *Record, src *Source) {
+	t.t.AddFrom(r, src)
+}
+
+// Aggregate coarsens the tree so that it contains at most n leaves.
+// See TreeOf.Aggregate for details.
+func (t *Tree) Aggregate(n int) uint64 {
+	return t.t.Aggregate(n)
+}
+
+func (t *Tree) walk(cb func(r *Record, ud interface{}), ud interface{}) {
+	t.t.walk(cb, ud)
+}
+
+// Add append a record to the tree, overwrite controls the behaivor
+// when join overlapped IP sets with different values. If true, the
+// latter wins.
+func (t *TreeOf[T]) Add(r *RecordOf[T], overwrite bool) {
+	wins := func(*node) bool {
+		return overwrite
+	}
+	t.add(r, 0, wins, overwrite)
+}
+
+// add inserts a record from source s. wins decides whether the record
+// replaces an existing leaf, all tells it always does.
+func (t *TreeOf[T]) add(r *RecordOf[T], s uint16, wins func(n *node) bool, all bool) {
+	t.init()
+
 	prefix := r.i.prefix
 	size := r.i.size
 	mask := uint32(1 << 31)
-	n := &t.root
+	leaf := node{v: t.intern(r.v), s: s, leaf: true}
+	n := uint32(0)
+
+	if size == 0 {
+		// the whole address space, the root itself
+		rt := &t.nodes[0]
+		switch {
+		case rt.leaf:
+			if !t.equiv(rt, &leaf) && wins(rt) {
+				rt.v = leaf.v
+				rt.s = leaf.s
+			}
+		case all:
+			for _, c := range rt.c {
+				if c != 0 {
+					t.drop(c)
+				}
+			}
+			t.nodes[0] = leaf
+		default:
+			t.fill(0, &leaf, wins)
+		}
+		return
+	}
 
 	// if mod == true, we need try to combine adjacent nodes
 	mod := false
 
 	for depth := 1; depth <= size; depth++ {
-		msb := (prefix & mask) >> 31
-		prefix <<= 1
-
 		// for Target branch and the Other branch
-		var tbranch, obranch **node
-		if msb == 0 {
-			tbranch = &n.l
-			obranch = &n.r
-		} else {
-			tbranch = &n.r
-			obranch = &n.l
-		}
+		tb := (prefix & mask) >> 31
+		ob := 1 - tb
+		prefix <<= 1
 
-		if n.leaf {
+		if t.nodes[n].leaf {
 			// reach a leaf without the need to go deeper
-			if !overwrite || vequal(n.v, r.v) {
+			old := t.nodes[n]
+			if t.equiv(&old, &leaf) || !wins(&old) {
 				break
 			}
-			n.leaf = false
-			*tbranch = &node{p: n}
-			(*tbranch).leaf = true
+			// always add new node as a leaf to keep original info
+			tl := old
 			if depth == size {
-				(*tbranch).v = r.v
-			} else {
-				// always add new node as a leaf to keep original info
-				(*tbranch).v = n.v
+				tl = leaf
 			}
-			*obranch = &node{p: n, v: n.v, leaf: true}
-			n.v = nil
+			tl.p = n
+			old.p = n
+			tc := t.alloc(tl)
+			oc := t.alloc(old)
+			nd := &t.nodes[n]
+			nd.leaf = false
+			nd.c[tb] = tc
+			nd.c[ob] = oc
+			nd.v = 0
+			nd.s = 0
 			mod = true
 		} else {
+			c := t.nodes[n].c[tb]
 			if depth == size {
-				// unfinished node, not leaf, but no child
-				if overwrite || (*tbranch == nil) {
-					*tbranch = &node{p: n, v: r.v, leaf: true}
+				switch {
+				case c == 0 || all:
+					// unfinished node, not leaf, but no child
+					if c != 0 {
+						t.drop(c)
+					}
+					l := leaf
+					l.p = n
+					t.nodes[n].c[tb] = t.alloc(l)
 					mod = true
-				} else {
-					fill(*tbranch, r.v)
-					// deal compression inside fill
-					mod = false
+				case t.nodes[c].leaf:
+					cn := &t.nodes[c]
+					if !t.equiv(cn, &leaf) && wins(cn) {
+						cn.v = leaf.v
+						cn.s = leaf.s
+						mod = true
+					}
+				default:
+					t.fill(c, &leaf, wins)
+					// fill turns c into a leaf if the whole subtree
+					// is covered, it may combine with its sibling
+					mod = t.nodes[c].leaf
 				}
 			} else {
-				if *tbranch == nil {
-					*tbranch = &node{p: n}
+				if c == 0 {
+					t.nodes[n].c[tb] = t.alloc(node{p: n})
 					mod = true
 				}
 			}
 		}
-		n = *tbranch
+		n = t.nodes[n].c[tb]
 	}
 
 	if mod {
-		compress(n)
+		t.compress(n)
 	}
 }
 
+// Delete removes all the addresses of the prefix i from the tree,
+// records partly overlapped are split.
+func (t *TreeOf[T]) Delete(i *net.IPNet) error {
+	var zero T
+	r, err := RecordOfCIDR(i, zero)
+	if err != nil {
+		return err
+	}
+	t.remove(r.i, func(*node) bool { return true })
+	return nil
+}
+
+// DeleteRecord removes the addresses of the prefix of r which are
+// associated with the value of r, others are left untouched.
+func (t *TreeOf[T]) DeleteRecord(r *RecordOf[T]) {
+	t.remove(r.i, func(n *node) bool {
+		return t.equal(t.vals[n.v], r.v)
+	})
+}
+
+// remove drops the leaves matched inside the subnet c.
+func (t *TreeOf[T]) remove(c cidr, match func(n *node) bool) {
+	if len(t.nodes) == 0 {
+		return
+	}
+
+	prefix := c.prefix
+	n := uint32(0)
+	for depth := 1; depth <= c.size; depth++ {
+		tb := prefix >> 31
+		prefix <<= 1
+
+		if t.nodes[n].leaf {
+			if !match(&t.nodes[n]) {
+				return
+			}
+			// split the leaf, the part outside is kept
+			old := t.nodes[n]
+			old.p = n
+			l := t.alloc(old)
+			r := t.alloc(old)
+			nd := &t.nodes[n]
+			nd.leaf = false
+			nd.c = [2]uint32{l, r}
+			nd.v = 0
+			nd.s = 0
+		}
+
+		c := t.nodes[n].c[tb]
+		if c == 0 {
+			return
+		}
+		n = c
+	}
+
+	if !t.prune(n, match) {
+		return
+	}
+
+	// cut off the nodes left without children
+	for n != 0 {
+		p := t.nodes[n].p
+		pn := &t.nodes[p]
+		if pn.c[0] == n {
+			pn.c[0] = 0
+		} else {
+			pn.c[1] = 0
+		}
+		t.release(n)
+		if pn.c[0] != 0 || pn.c[1] != 0 {
+			return
+		}
+		n = p
+	}
+	t.nodes[0] = node{}
+}
+
+// prune drops the leaves matched in the subtree n, returns true if
+// nothing left in it. n itself is not released.
+func (t *TreeOf[T]) prune(n uint32, match func(n *node) bool) bool {
+	if t.nodes[n].leaf {
+		return match(&t.nodes[n])
+	}
+
+	empty := true
+	for i, c := range t.nodes[n].c {
+		if c == 0 {
+			continue
+		}
+		if t.prune(c, match) {
+			t.release(c)
+			t.nodes[n].c[i] = 0
+		} else {
+			empty = false
+		}
+	}
+	return empty
+}
+
 // Dump prints all the records inside the tree one by one.
-func (t *Tree) Dump() string {
-	cb := func(r *Record, ud interface{}) {
+func (t *TreeOf[T]) Dump() string {
+	cb := func(r *RecordOf[T], ud interface{}) {
 		arr := ud.(*[]string)
 		*arr = append(*arr, r.String())
 	}
@@ -103,87 +345,183 @@ func (t *Tree) Dump() string {
 	return strings.Join(s, "\n")
 }
 
-// Lookup find the associated payload of an IP from the tree. It
-// returns the payload and true on success, otherwise, returns false,
-// and the payload returned is undefined.
-func (t *Tree) Lookup(ip net.IP) (Payload, bool) {
-	if t == nil {
+// Load reads records in the format produced by Dump from r, one
+// "a.b.c.d/n (payload)" per line, and builds a tree from them. The
+// text inside the parentheses is unquoted if needed and converted back
+// by decode, note that records with nil payload are dumped as "-".
+// Empty lines are ignored. Source names following the payload are
+// restored as sources with priority 0.
+func Load(r io.Reader, decode func(string) (Payload, error)) (*Tree, error) {
+	t := NewTable()
+	srcs := make(map[string]*Source)
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+
+		i := strings.IndexByte(line, ' ')
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: %w", n, ErrSyntax)
+		}
+		text := strings.TrimSpace(line[i+1:])
+		if !strings.HasPrefix(text, "(") {
+			return nil, fmt.Errorf("line %d: %w", n, ErrSyntax)
+		}
+		p, rest, err := unquote(text[1:], ')')
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		var src *Source
+		if rest != "" {
+			if !strings.HasPrefix(rest, " [") {
+				return nil, fmt.Errorf("line %d: %w", n, ErrSyntax)
+			}
+			name, rest, err := unquote(rest[2:], ']')
+			if err != nil || rest != "" {
+				return nil, fmt.Errorf("line %d: %w", n, ErrSyntax)
+			}
+			if src = srcs[name]; src == nil {
+				src = &Source{Name: name}
+				srcs[name] = src
+			}
+		}
+
+		v, err := decode(p)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		rec, err := ParseCIDR(line[:i], v)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		t.AddFrom(rec, src)
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Lookup find the associated value of an IP from the tree. It
+// returns the value and true on success, otherwise, returns false,
+// and the value returned is undefined.
+func (t *TreeOf[T]) Lookup(ip net.IP) (T, bool) {
+	var zero T
+	n, _ := t.find(ipToNum(ip))
+	if n == nil {
+		return zero, false
+	}
+	return t.vals[n.v], true
+}
+
+// LookupRecord is like Lookup, but returns the whole record the IP
+// belongs to, including the prefix and source.
+func (t *TreeOf[T]) LookupRecord(ip net.IP) (*RecordOf[T], bool) {
+	addr := ipToNum(ip)
+	n, depth := t.find(addr)
+	if n == nil {
 		return nil, false
 	}
+	return &RecordOf[T]{
+		i: cidr{
+			prefix: addr & sizeToMask(depth),
+			size:   depth,
+		},
+		v: t.vals[n.v],
+		s: t.sourceOf(n),
+	}, true
+}
+
+// find returns the leaf covering addr and its depth, or nil if not
+// found.
+func (t *TreeOf[T]) find(addr uint32) (*node, int) {
+	if t == nil || len(t.nodes) == 0 {
+		return nil, 0
+	}
 
-	prefix := ipToNum(ip)
+	prefix := addr
 	mask := uint32(1 << 31)
-	n := &t.root
+	n := &t.nodes[0]
+	if n.leaf {
+		// whole address space aggregated into one leaf
+		return n, 0
+	}
 	for depth := 1; depth <= 32; depth++ {
 		msb := (prefix & mask) >> 31
 		prefix <<= 1
 
-		if msb == 0 {
-			n = n.l
-		} else {
-			n = n.r
-		}
-
-		if n == nil {
-			return nil, false
+		c := n.c[msb]
+		if c == 0 {
+			return nil, 0
 		}
 
+		n = &t.nodes[c]
 		if n.leaf {
-			return n.v, true
+			return n, depth
 		}
 	}
 	panic("should not reach here")
 }
 
-func (t *Tree) walk(cb func(r *Record, ud interface{}), ud interface{}) {
+func (t *TreeOf[T]) walk(cb func(r *RecordOf[T], ud interface{}), ud interface{}) {
 	var f func(n *node, prefix uint32, depth int)
 	f = func(n *node, prefix uint32, depth int) {
 		if n.leaf {
-			r := &Record{
+			r := &RecordOf[T]{
 				i: cidr{
 					prefix: prefix << uint(32-depth),
 					size:   depth,
 				},
-				v: n.v,
+				v: t.vals[n.v],
+				s: t.sourceOf(n),
 			}
 			cb(r, ud)
 		} else {
 			prefix <<= 1
 			depth++
-			if n.l != nil {
-				f(n.l, prefix, depth)
+			if n.c[0] != 0 {
+				f(&t.nodes[n.c[0]], prefix, depth)
 			}
 			prefix |= 1
-			if n.r != nil {
-				f(n.r, prefix, depth)
+			if n.c[1] != 0 {
+				f(&t.nodes[n.c[1]], prefix, depth)
 			}
 		}
 	}
 
-	f(&t.root, 0, 0)
+	if len(t.nodes) != 0 {
+		f(&t.nodes[0], 0, 0)
+	}
 }
 
 // compress cut off the useless nodes from a subtree n, returns the
 // number of changes.
-func compress(n *node) int64 {
-	if !n.leaf {
+func (t *TreeOf[T]) compress(n uint32) int64 {
+	if !t.nodes[n].leaf {
 		panic("must be a leaf")
 	}
 
 	var delta int64
 
-	for {
-		p := n.p
-		if p == nil {
-			break
-		}
-		if p.l != nil && p.r != nil &&
-			p.l.leaf && p.r.leaf &&
-			vequal(p.l.v, p.r.v) {
-			p.leaf = true
-			p.v = p.l.v
-			p.l = nil
-			p.r = nil
+	// root is the only node without parent
+	for n != 0 {
+		p := t.nodes[n].p
+		pn := &t.nodes[p]
+		l, r := pn.c[0], pn.c[1]
+		if l != 0 && r != 0 &&
+			t.nodes[l].leaf && t.nodes[r].leaf &&
+			t.equiv(&t.nodes[l], &t.nodes[r]) {
+			pn.leaf = true
+			pn.v = t.nodes[l].v
+			pn.s = t.nodes[l].s
+			pn.c = [2]uint32{}
+			t.release(l)
+			t.release(r)
 			n = p
 			delta--
 		} else {
@@ -193,49 +531,71 @@ func compress(n *node) int64 {
 	return delta
 }
 
-// fill create missing leaves in the subtree n with payload v. Return
-// number of nodes changed and the clear(subtree is no need to change)
-// flag.
-func fill(n *node, v Payload) (int64, bool) {
-	f := func(n *node, v Payload) (int64, bool) {
-		if n == nil {
+// fill create missing leaves in the subtree n with leaf, existing
+// leaves are replaced if wins. Return number of nodes changed and the
+// clear(subtree is no need to change) flag.
+func (t *TreeOf[T]) fill(n uint32, leaf *node, wins func(n *node) bool) (int64, bool) {
+	f := func(c uint32) (int64, bool) {
+		if c == 0 {
 			return 0, true
-		} else if n.leaf {
+		}
+		cn := &t.nodes[c]
+		if cn.leaf {
 			// compare, return merge result
-			if vequal(n.v, v) {
+			if t.equiv(cn, leaf) || wins(cn) {
 				return -1, true
 			}
 			return 0, false
-		} else {
-			return fill(n, v)
 		}
+		return t.fill(c, leaf, wins)
 	}
 
-	dl, cl := f(n.l, v)
-	dr, cr := f(n.r, v)
+	dl, cl := f(t.nodes[n].c[0])
+	dr, cr := f(t.nodes[n].c[1])
 
 	// n.l == nil && n.r == nil
 	// should be handled in previous iteration
 
 	if cl && cr {
-		n.v = v
-		n.leaf = true
-		n.l = nil
-		n.r = nil
+		for _, c := range t.nodes[n].c {
+			if c != 0 {
+				t.release(c)
+			}
+		}
+		nd := &t.nodes[n]
+		nd.v = leaf.v
+		nd.s = leaf.s
+		nd.leaf = true
+		nd.c = [2]uint32{}
 		return dl + dr, true
 	}
 
-	if n.l == nil {
-		n.l = &node{p: n, v: v, leaf: true}
-		return 1, false
+	for i, c := range t.nodes[n].c {
+		switch {
+		case c == 0:
+			l := *leaf
+			l.p = n
+			t.nodes[n].c[i] = t.alloc(l)
+		case t.nodes[c].leaf && wins(&t.nodes[c]):
+			t.nodes[c].v = leaf.v
+			t.nodes[c].s = leaf.s
+		}
 	}
 
-	if n.r == nil {
-		n.r = &node{p: n, v: v, leaf: true}
-		return 1, false
+	return dl + dr, false
+}
+
+// equal compares two values with the function given at creation.
+func (t *TreeOf[T]) equal(a, b T) bool {
+	if t.eq != nil {
+		return t.eq(a, b)
 	}
 
-	return dl + dr, false
+	if pa, ok := any(a).(Payload); ok {
+		pb, _ := any(b).(Payload)
+		return vequal(pa, pb)
+	}
+	return any(a) == any(b)
 }
 
 func vequal(a, b Payload) bool {
@@ -249,3 +609,34 @@ func vequal(a, b Payload) bool {
 
 	return a.Equal(b)
 }
+
+// Len returns the number of records inside the tree.
+func (t *TreeOf[T]) Len() int {
+	var n int
+	t.walk(func(*RecordOf[T], interface{}) { n++ }, nil)
+	return n
+}
+
+// Stats is a summary of a tree.
+type Stats struct {
+	Records   int    `json:"records"`   // number of records
+	Addresses uint64 `json:"addresses"` // number of addresses covered
+	Nodes     int    `json:"nodes"`     // number of nodes in use
+	Values    int    `json:"values"`    // number of distinct values stored
+	Sources   int    `json:"sources"`   // number of sources known
+}
+
+// Stats returns the summary of the tree.
+func (t *TreeOf[T]) Stats() Stats {
+	var s Stats
+	t.walk(func(r *RecordOf[T], ud interface{}) {
+		s.Records++
+		s.Addresses += uint64(1) << uint(32-r.i.size)
+	}, nil)
+	s.Nodes = len(t.nodes) - len(t.free)
+	s.Values = len(t.vals)
+	if len(t.srcs) > 0 {
+		s.Sources = len(t.srcs) - 1
+	}
+	return s
+}
@@ -0,0 +1,135 @@
+package geoip
+
+import (
+	"net"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+func TestTreeOf(t *testing.T) {
+	ta := NewTreeOf[int]()
+	for _, in := range []struct {
+		cidr      string
+		v         int
+		overwrite bool
+	}{
+		{"1.0.0.0/29", 1, false},
+		{"1.0.0.8/29", 1, false},
+		{"1.0.0.4/31", 2, true},
+	} {
+		_, cidr, _ := net.ParseCIDR(in.cidr)
+		r, err := RecordOfCIDR(cidr, in.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ta.Add(r, in.overwrite)
+	}
+
+	exp := "1.0.0.0/30 (1)\n1.0.0.4/31 (2)\n1.0.0.6/31 (1)\n1.0.0.8/29 (1)"
+	if out := ta.Dump(); out != exp {
+		t.Errorf("want: [%s]\nget: [%s]", exp, out)
+	}
+
+	if v, ok := ta.Lookup(net.ParseIP("1.0.0.5")); !ok || v != 2 {
+		t.Errorf("want: 2, get: %d", v)
+	}
+	if v, ok := ta.Lookup(net.ParseIP("1.0.0.16")); ok || v != 0 {
+		t.Errorf("want: none, get: %d", v)
+	}
+}
+
+func TestTreeFunc(t *testing.T) {
+	type loc struct {
+		country string
+		cities  []string
+	}
+	eq := func(a, b loc) bool { return a.country == b.country }
+	ta := NewTreeFunc(eq)
+
+	rs, _ := RecordsOfRange(net.ParseIP("1.0.0.0"), net.ParseIP("1.0.0.5"),
+		loc{"AA", []string{"a"}})
+	for _, r := range rs {
+		ta.Add(r, false)
+	}
+	_, cidr, _ := net.ParseCIDR("1.0.0.6/31")
+	r, _ := RecordOfCIDR(cidr, loc{"AA", []string{"b"}})
+	ta.Add(r, true)
+
+	exp := "1.0.0.0/29 ({AA [a]})"
+	if out := ta.Dump(); out != exp {
+		t.Errorf("want: [%s]\nget: [%s]", exp, out)
+	}
+}
+
+func TestTreeZero(t *testing.T) {
+	var ta Tree
+	for _, in := range []string{"1.0.0.0/25", "1.0.0.128/25"} {
+		_, cidr, _ := net.ParseCIDR(in)
+		ta.Add(NewRecordFromCIDR(cidr, ps("A")), false)
+	}
+	if out := ta.Dump(); out != "1.0.0.0/24 (A)" {
+		t.Errorf("want: [1.0.0.0/24 (A)]\nget: [%s]", out)
+	}
+}
+
+// cityTable builds a table like a full city database, with n /24
+// records sharing a limited set of payloads created per record.
+func cityTable(n int) *Tree {
+	ta := NewTable()
+	for i := 0; i < n; i++ {
+		city := ps("city-" + strconv.Itoa(i*7919%(1<<14)))
+		r := &Record{
+			i: cidr{prefix: uint32(i) << 8, size: 24},
+			v: city,
+		}
+		ta.Add(r, false)
+	}
+	return ta
+}
+
+func BenchmarkAddCity(b *testing.B) {
+	const records = 1 << 21
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		ta := cityTable(records)
+
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/records, "heap-B/record")
+		runtime.KeepAlive(ta)
+	}
+}
+
+func BenchmarkLookupCity(b *testing.B) {
+	const records = 1 << 21
+	ta := cityTable(records)
+	ips := make([]net.IP, 1<<10)
+	for i := range ips {
+		ips[i] = numToIP(uint32(i*104729) % (records << 8))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, ok := ta.Lookup(ips[i%len(ips)]); !ok {
+			b.Fatal("lookup failed")
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	ta := NewTable()
+	for _, in := range []string{"1.0.0.0/24", "2.0.0.0/23", "2.0.2.0/32"} {
+		_, cidr, _ := net.ParseCIDR(in)
+		ta.AddFrom(NewRecordFromCIDR(cidr, ps(in)), &Source{Name: in})
+	}
+	s := ta.Stats()
+	if s.Records != 3 || s.Addresses != 256+512+1 || s.Values != 3 || s.Sources != 3 {
+		t.Errorf("get: %+v", s)
+	}
+}
@@ -0,0 +1,81 @@
+package log
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// key used for a value without a valid key, same as log/slog
+const badKey = "!BADKEY"
+
+// field is a key-value pair attached to a log entry
+type field struct {
+	key   string
+	value interface{}
+}
+
+// convert alternating keys and values into fields. A non-string key
+// or a key without value is kept with badKey as its key.
+func toFields(kv []interface{}) []field {
+	fs := make([]field, 0, (len(kv)+1)/2)
+	for len(kv) > 0 {
+		k, ok := kv[0].(string)
+		if !ok || len(kv) == 1 {
+			fs = append(fs, field{badKey, kv[0]})
+			kv = kv[1:]
+			continue
+		}
+		fs = append(fs, field{k, kv[1]})
+		kv = kv[2:]
+	}
+	return fs
+}
+
+// render the message followed by the fields in the form of
+// key=value, values are quoted when needed.
+func formatText(msg string, fs []field) string {
+	if len(fs) == 0 {
+		return msg
+	}
+
+	var b strings.Builder
+	b.WriteString(msg)
+	for _, f := range fs {
+		b.WriteByte(' ')
+		b.WriteString(quote(f.key))
+		b.WriteByte('=')
+		b.WriteString(quote(valueString(f.value)))
+	}
+	return b.String()
+}
+
+func valueString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "<nil>"
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// quote s if it is empty or contains spaces, quotes, '=' or non
+// printable characters.
+func quote(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if r == '=' || r == '"' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
@@ -0,0 +1,27 @@
+package log
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFormatText(t *testing.T) {
+	cases := []struct {
+		kv []interface{}
+		o  string
+	}{
+		{nil, "msg"},
+		{[]interface{}{"k", 1, "s", "a b"}, `msg k=1 s="a b"`},
+		{[]interface{}{"eq", "a=b", "empty", "", "q", `"`}, `msg eq="a=b" empty="" q="\""`},
+		{[]interface{}{"err", errors.New("x y"), "nil", nil}, `msg err="x y" nil=<nil>`},
+		{[]interface{}{"odd"}, "msg !BADKEY=odd"},
+		{[]interface{}{1, "v", "k", 2}, "msg !BADKEY=1 v=k !BADKEY=2"},
+		{[]interface{}{"a b", 1, "tab", "\t"}, `msg "a b"=1 tab="\t"`},
+	}
+
+	for _, c := range cases {
+		if out := formatText("msg", toFields(c.kv)); out != c.o {
+			t.Errorf("input: %v, want: [%s], get: [%s]", c.kv, c.o, out)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// layout of the suffix of rotated files, sorts in time order
+const rotateLayout = "20060102-150405.000000000"
+
+// File is an io.Writer appending to a log file, which is rotated by
+// size and/or age. Rotated files are renamed with a timestamp suffix,
+// e.g. app.log.20240102-150405.000000000, and optionally compressed
+// in background. Use it with NewWriterSink.
+//
+// Settings must not be changed after the first Write.
+type File struct {
+	// MaxSize is the size in bytes a file is rotated before exceeding,
+	// 0 for no limit.
+	MaxSize int64
+	// MaxAge is the time a file is rotated after being opened, 0 for
+	// no limit.
+	MaxAge time.Duration
+	// Keep is the number of rotated files kept, 0 keeps all.
+	Keep int
+	// Compress rotated files with gzip.
+	Compress bool
+
+	path string
+
+	mu     sync.Mutex // protects fields below
+	f      *os.File
+	size   int64
+	opened time.Time
+	closed bool // by Close, until Reopen
+
+	bg sync.Mutex // serializes background work
+	wg sync.WaitGroup
+}
+
+// open the log file at path for appending, it is created if not
+// exists
+func NewFile(path string) (*File, error) {
+	f := &File{path: path}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) open() error {
+	fd, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return err
+	}
+
+	f.f = fd
+	f.size = fi.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+// append p to the file, rotating it first if needed
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.f == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	full := f.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.MaxSize
+	old := f.MaxAge > 0 && time.Since(f.opened) >= f.MaxAge
+	if full || old {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.f.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate the file now
+func (f *File) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+// close and open the file again, e.g. after it was moved by an
+// external tool like logrotate. a closed file is opened again.
+func (f *File) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.f != nil {
+		f.f.Close()
+		f.f = nil
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.closed = false
+	return nil
+}
+
+// close the file and wait for background compression. Write fails
+// with os.ErrClosed until Reopen.
+func (f *File) Close() error {
+	f.mu.Lock()
+	var err error
+	if f.f != nil {
+		err = f.f.Close()
+		f.f = nil
+	}
+	f.closed = true
+	f.mu.Unlock()
+
+	// no rotation starts once closed, so writers are not blocked
+	// while waiting
+	f.wg.Wait()
+	return err
+}
+
+// rename the current file and open a new one. must be called with
+// f.mu held.
+func (f *File) rotate() error {
+	if f.f != nil {
+		f.f.Close()
+		f.f = nil
+	}
+
+	// a free name, the time is bumped in the unlikely case of
+	// collision
+	t := time.Now()
+	var name string
+	for {
+		name = f.path + "." + t.Format(rotateLayout)
+		if _, err := os.Lstat(name); os.IsNotExist(err) {
+			if _, err := os.Lstat(name + ".gz"); os.IsNotExist(err) {
+				break
+			}
+		}
+		t = t.Add(time.Nanosecond)
+	}
+
+	if err := os.Rename(f.path, name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	f.wg.Add(1)
+	go f.cleanup()
+	return nil
+}
+
+// compress the rotated files if needed, and remove the oldest ones
+// beyond f.Keep. errors are ignored, files failed to compress are
+// retried by the next rotation.
+func (f *File) cleanup() {
+	defer f.wg.Done()
+	f.bg.Lock()
+	defer f.bg.Unlock()
+
+	olds := f.rotated()
+	if f.Compress {
+		for i, o := range olds {
+			if !strings.HasSuffix(o, ".gz") && compressFile(o) == nil {
+				olds[i] = o + ".gz"
+			}
+		}
+	}
+	if f.Keep <= 0 || len(olds) <= f.Keep {
+		return
+	}
+	for _, o := range olds[:len(olds)-f.Keep] {
+		os.Remove(o)
+	}
+}
+
+// rotated files of f, oldest first. of a file and its compressed
+// form, only the former is returned as the compression did not
+// finish.
+func (f *File) rotated() []string {
+	dir, base := filepath.Split(f.path)
+	if dir == "" {
+		dir = "."
+	}
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	for _, e := range ents {
+		seen[e.Name()] = true
+	}
+
+	var names []string
+	for _, e := range ents {
+		n := e.Name()
+		if !strings.HasPrefix(n, base+".") {
+			continue
+		}
+		plain := strings.TrimSuffix(n, ".gz")
+		if plain != n && seen[plain] {
+			continue
+		}
+		if _, err := time.Parse(rotateLayout, plain[len(base)+1:]); err != nil {
+			continue
+		}
+		names = append(names, filepath.Join(dir, n))
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		return strings.TrimSuffix(names[i], ".gz") < strings.TrimSuffix(names[j], ".gz")
+	})
+	return names
+}
+
+// compress name into name.gz and remove it, name.gz left by an
+// interrupted attempt is overwritten
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(name+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name + ".gz")
+		return err
+	}
+	return os.Remove(name)
+}
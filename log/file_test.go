@@ -0,0 +1,305 @@
+package log
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var rotatedName = regexp.MustCompile(`^app\.log\.\d{8}-\d{6}\.\d{9}(\.gz)?$`)
+
+// names of rotated files in dir, oldest first
+func rotatedFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range ents {
+		if e.Name() == "app.log" {
+			continue
+		}
+		if !rotatedName.MatchString(e.Name()) {
+			t.Errorf("unexpected file: %s", e.Name())
+		}
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func gunzipFile(t *testing.T, path string) string {
+	t.Helper()
+	fd, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	zr, err := gzip.NewReader(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestFileSize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	f, err := NewFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.MaxSize = 10
+
+	for _, s := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddddddddddddddd\n", "e\n"} {
+		if _, err := f.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a line larger than MaxSize is still written in one file
+	olds := rotatedFiles(t, dir)
+	var got []string
+	for _, o := range olds {
+		got = append(got, readFile(t, filepath.Join(dir, o)))
+	}
+	exp := []string{"aaaa\nbbbb\n", "cccc\n", "dddddddddddddddd\n"}
+	if strings.Join(got, "|") != strings.Join(exp, "|") {
+		t.Errorf("want: %q, get: %q", exp, got)
+	}
+	if out := readFile(t, path); out != "e\n" {
+		t.Errorf("current, get: %q", out)
+	}
+
+	// closed until Reopen
+	if _, err := f.Write([]byte("x\n")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("want: %v, get: %v", os.ErrClosed, err)
+	}
+	if err := f.Rotate(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("want: %v, get: %v", os.ErrClosed, err)
+	}
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("f\n"))
+	f.Close()
+	if out := readFile(t, path); out != "e\nf\n" {
+		t.Errorf("current, get: %q", out)
+	}
+}
+
+func TestFileAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	f, err := NewFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.MaxAge = 20 * time.Millisecond
+
+	f.Write([]byte("a\n"))
+	f.Write([]byte("b\n"))
+	time.Sleep(30 * time.Millisecond)
+	f.Write([]byte("c\n"))
+	f.Close()
+
+	olds := rotatedFiles(t, dir)
+	if len(olds) != 1 || readFile(t, filepath.Join(dir, olds[0])) != "a\nb\n" {
+		t.Errorf("get: %v", olds)
+	}
+	if out := readFile(t, path); out != "c\n" {
+		t.Errorf("current, get: %q", out)
+	}
+}
+
+func TestFileKeepCompress(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	f, err := NewFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Keep = 2
+	f.Compress = true
+
+	// a rotated file failed to compress before, with a partial .gz
+	stale := path + "." + time.Now().Add(-time.Hour).Format(rotateLayout)
+	os.WriteFile(stale, []byte("stale\n"), 0644)
+	os.WriteFile(stale+".gz", []byte("partial"), 0644)
+
+	for _, s := range []string{"1\n", "2\n", "3\n"} {
+		f.Write([]byte(s))
+		if err := f.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Write([]byte("4\n"))
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the oldest ones, including the stale file, are removed
+	olds := rotatedFiles(t, dir)
+	if len(olds) != 2 {
+		t.Fatalf("want 2 rotated files, get: %v", olds)
+	}
+	for i, exp := range []string{"2\n", "3\n"} {
+		if !strings.HasSuffix(olds[i], ".gz") {
+			t.Errorf("not compressed: %s", olds[i])
+			continue
+		}
+		if out := gunzipFile(t, filepath.Join(dir, olds[i])); out != exp {
+			t.Errorf("%s, want: %q, get: %q", olds[i], exp, out)
+		}
+	}
+	if out := readFile(t, path); out != "4\n" {
+		t.Errorf("current, get: %q", out)
+	}
+}
+
+func TestFileRetryCompress(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	f, err := NewFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Compress = true
+
+	stale := path + "." + time.Now().Add(-time.Hour).Format(rotateLayout)
+	os.WriteFile(stale, []byte("stale\n"), 0644)
+	os.WriteFile(stale+".gz", []byte("partial"), 0644)
+	f.Rotate()
+	f.Close()
+
+	if out := gunzipFile(t, stale+".gz"); out != "stale\n" {
+		t.Errorf("get: %q", out)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("uncompressed file left: %v", err)
+	}
+	if olds := rotatedFiles(t, dir); len(olds) != 2 {
+		t.Errorf("get: %v", olds)
+	}
+}
+
+func TestFileReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	f, err := NewFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("a\n"))
+	// moved away by an external tool
+	moved := filepath.Join(dir, "moved")
+	if err := os.Rename(path, moved); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("b\n"))
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("c\n"))
+
+	if out := readFile(t, moved); out != "a\nb\n" {
+		t.Errorf("moved, get: %q", out)
+	}
+	if out := readFile(t, path); out != "c\n" {
+		t.Errorf("reopened, get: %q", out)
+	}
+}
+
+func TestFileConcurrentClose(t *testing.T) {
+	dir := t.TempDir()
+	f, err := NewFile(filepath.Join(dir, "app.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.MaxSize = 8
+	f.Compress = true
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			f.Write([]byte("line\n"))
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		f.Close()
+	}
+	<-done
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileCloseNotBlocking(t *testing.T) {
+	f, err := NewFile(filepath.Join(t.TempDir(), "app.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Compress = true
+
+	// stall the background compression
+	f.bg.Lock()
+	f.Write([]byte("a\n"))
+	f.Rotate()
+	closed := make(chan error)
+	go func() { closed <- f.Close() }()
+
+	written := make(chan error)
+	go func() {
+		// the file may or may not be closed yet
+		for {
+			if _, err := f.Write([]byte("b\n")); err != nil {
+				written <- err
+				return
+			}
+		}
+	}()
+	select {
+	case err := <-written:
+		if !errors.Is(err, os.ErrClosed) {
+			t.Errorf("want: %v, get: %v", os.ErrClosed, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Write blocked by Close")
+	}
+
+	select {
+	case <-closed:
+		t.Error("Close returned before compression")
+	default:
+	}
+	f.bg.Unlock()
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,259 @@
+package log
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// default socket of native protocol
+const journalSocket = "/run/systemd/journal/socket"
+
+// memfd_create(2) is missing from syscall package on some
+// architectures
+var sysMemfdCreate = map[string]uintptr{
+	"386":     356,
+	"amd64":   319,
+	"arm":     385,
+	"arm64":   279,
+	"loong64": 279,
+	"ppc64":   360,
+	"ppc64le": 360,
+	"riscv64": 279,
+	"s390x":   350,
+}
+
+const (
+	mfdCloexec      = 0x1
+	mfdAllowSealing = 0x2
+	fAddSeals       = 1033
+	// F_SEAL_SEAL|F_SEAL_SHRINK|F_SEAL_GROW|F_SEAL_WRITE
+	sealAll = 0xf
+)
+
+// Journal is a sink writing to systemd-journald with its native
+// protocol. The message, priority, identifier, source of the caller
+// and fields are sent as separate journal fields, field keys are
+// converted into upper case journal field names, e.g. "req-id" into
+// REQ_ID. Keys colliding with the fields of the entry itself are
+// prefixed, e.g. "priority" into FIELDS_PRIORITY. Entries too large
+// for a datagram are passed in a memfd.
+//
+// Settings must not be changed after the first entry.
+type Journal struct {
+	Identifier string // SYSLOG_IDENTIFIER, base name of program by default
+
+	addr *net.UnixAddr
+	min  level
+
+	mu   sync.Mutex
+	conn *net.UnixConn
+}
+
+// create a sink writing entries at level min or above to journald
+// listening at addr, the default socket if empty
+func NewJournal(addr, min string) (*Journal, error) {
+	lvl, err := parseLevel(min)
+	if err != nil {
+		return nil, err
+	}
+	if addr == "" {
+		addr = journalSocket
+	}
+	if _, err := os.Stat(addr); err != nil {
+		return nil, ErrOpenJournal
+	}
+
+	return &Journal{
+		Identifier: path.Base(os.Args[0]),
+		addr:       &net.UnixAddr{Name: addr, Net: "unixgram"},
+		min:        lvl,
+	}, nil
+}
+
+func (j *Journal) enabled(lvl level) bool {
+	return lvl <= j.min
+}
+
+func (j *Journal) write(e *entry, _ *Format) {
+	b := j.encode(e)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.send(b)
+}
+
+// close the socket, it is opened again by the next entry
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.conn == nil {
+		return nil
+	}
+	err := j.conn.Close()
+	j.conn = nil
+	return err
+}
+
+// render entry e in the native protocol
+func (j *Journal) encode(e *entry) []byte {
+	b := appendJournal(nil, "MESSAGE", e.msg)
+	b = appendJournal(b, "PRIORITY", strconv.Itoa(severity[e.level]))
+	if j.Identifier != "" {
+		b = appendJournal(b, "SYSLOG_IDENTIFIER", j.Identifier)
+	}
+	if e.pc != 0 {
+		f, _ := runtime.CallersFrames([]uintptr{e.pc}).Next()
+		b = appendJournal(b, "CODE_FILE", f.File)
+		b = appendJournal(b, "CODE_LINE", strconv.Itoa(f.Line))
+		b = appendJournal(b, "CODE_FUNC", f.Function)
+	}
+	for _, f := range e.fields {
+		name := journalName(f.key)
+		if journalReserved[name] {
+			name = journalName("fields." + name)
+		}
+		b = appendJournal(b, name, valueString(f.value))
+	}
+	return b
+}
+
+// journal fields written for the entry itself
+var journalReserved = map[string]bool{
+	"MESSAGE":           true,
+	"PRIORITY":          true,
+	"SYSLOG_IDENTIFIER": true,
+	"CODE_FILE":         true,
+	"CODE_LINE":         true,
+	"CODE_FUNC":         true,
+}
+
+// append a field, values with newlines are prefixed by their length
+func appendJournal(b []byte, k, v string) []byte {
+	b = append(b, k...)
+	if !strings.ContainsRune(v, '\n') {
+		b = append(b, '=')
+		b = append(b, v...)
+		return append(b, '\n')
+	}
+
+	b = append(b, '\n')
+	b = binary.LittleEndian.AppendUint64(b, uint64(len(v)))
+	b = append(b, v...)
+	return append(b, '\n')
+}
+
+// convert a key into a journal field name: upper case letters, digits
+// and underscores, not starting with an underscore or a digit, at
+// most 64 characters
+func journalName(k string) string {
+	b := []byte(strings.ToUpper(strings.TrimLeft(k, "_")))
+	for i, c := range b {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 || (b[0] >= '0' && b[0] <= '9') {
+		b = append([]byte{'F'}, b...)
+	}
+	if len(b) > 64 {
+		b = b[:64]
+	}
+	return string(b)
+}
+
+// send an encoded entry. must be called with j.mu held.
+func (j *Journal) send(b []byte) error {
+	if j.conn == nil {
+		c, err := unixgram()
+		if err != nil {
+			return err
+		}
+		j.conn = c
+	}
+
+	_, err := j.conn.WriteToUnix(b, j.addr)
+	if errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS) {
+		return j.sendFile(b)
+	}
+	if err != nil {
+		// open again for the next entry
+		j.conn.Close()
+		j.conn = nil
+	}
+	return err
+}
+
+// an unbound and not connected datagram socket, as file descriptors
+// can not be passed on a connected net.UnixConn
+func unixgram() (*net.UnixConn, error) {
+	fd, err := syscall.Socket(syscall.AF_UNIX, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	f := os.NewFile(uintptr(fd), "journal")
+	defer f.Close()
+
+	c, err := net.FileConn(f)
+	if err != nil {
+		return nil, err
+	}
+	return c.(*net.UnixConn), nil
+}
+
+// pass an entry too large for a datagram as a file descriptor
+func (j *Journal) sendFile(b []byte) error {
+	f, sealable, err := memfd()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(b); err != nil {
+		return err
+	}
+	if sealable {
+		// journald only maps sealed memfds
+		_, _, errno := syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), fAddSeals, sealAll)
+		if errno != 0 {
+			return errno
+		}
+	}
+
+	_, _, err = j.conn.WriteMsgUnix(nil, syscall.UnixRights(int(f.Fd())), j.addr)
+	if err != nil {
+		// open again for the next entry
+		j.conn.Close()
+		j.conn = nil
+	}
+	return err
+}
+
+// create a memfd, or an unlinked file in /dev/shm where memfd is not
+// available. it reports whether the file can be sealed.
+func memfd() (*os.File, bool, error) {
+	if nr, ok := sysMemfdCreate[runtime.GOARCH]; ok {
+		name := []byte("journal\x00")
+		fd, _, errno := syscall.Syscall(nr, uintptr(unsafe.Pointer(&name[0])),
+			mfdCloexec|mfdAllowSealing, 0)
+		if errno == 0 {
+			return os.NewFile(fd, "memfd:journal"), true, nil
+		}
+	}
+
+	f, err := os.CreateTemp("/dev/shm", "journal-")
+	if err != nil {
+		return nil, false, err
+	}
+	os.Remove(f.Name())
+	return f, false, nil
+}
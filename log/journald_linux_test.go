@@ -0,0 +1,190 @@
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// parse entries of the native protocol, fields must be unique
+func parseJournal(t *testing.T, b []byte) map[string]string {
+	t.Helper()
+	m := make(map[string]string)
+	for len(b) > 0 {
+		i := bytes.IndexAny(b, "=\n")
+		if i < 0 {
+			t.Fatalf("truncated entry: %q", b)
+		}
+		k := string(b[:i])
+		if _, dup := m[k]; dup {
+			t.Errorf("duplicate field: %s", k)
+		}
+		if b[i] == '=' {
+			b = b[i+1:]
+			j := bytes.IndexByte(b, '\n')
+			if j < 0 {
+				t.Fatalf("truncated value: %q", b)
+			}
+			m[k] = string(b[:j])
+			b = b[j+1:]
+			continue
+		}
+		b = b[i+1:]
+		if len(b) < 8 {
+			t.Fatalf("truncated length: %q", b)
+		}
+		n := binary.LittleEndian.Uint64(b)
+		b = b[8:]
+		if uint64(len(b)) < n+1 || b[n] != '\n' {
+			t.Fatalf("bad value of %s", k)
+		}
+		m[k] = string(b[:n])
+		b = b[n+1:]
+	}
+	return m
+}
+
+func listenJournal(t *testing.T) (string, *net.UnixConn) {
+	t.Helper()
+	addr := filepath.Join(t.TempDir(), "socket")
+	c, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return addr, c
+}
+
+func TestJournal(t *testing.T) {
+	addr, c := listenJournal(t)
+	j, err := NewJournal(addr, "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	j.Identifier = "test"
+
+	l := NewLogger()
+	l.SetLevel("debug")
+	l.SetSinks(j)
+	l.Debug("skipped")
+	l.Warn("hello", "req-id", 42, "_trace", "a\nb", "9x", true,
+		"priority", "high", "message", "m", "code_file", "f")
+
+	buf := make([]byte, 65536)
+	n, err := c.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := parseJournal(t, buf[:n])
+
+	want := map[string]string{
+		"MESSAGE":           "hello",
+		"PRIORITY":          "4",
+		"SYSLOG_IDENTIFIER": "test",
+		"REQ_ID":            "42",
+		"TRACE":             "a\nb",
+		"F9X":               "true",
+		"FIELDS_PRIORITY":   "high",
+		"FIELDS_MESSAGE":    "m",
+		"FIELDS_CODE_FILE":  "f",
+	}
+	for k, v := range want {
+		if m[k] != v {
+			t.Errorf("%s: got %q, want %q", k, m[k], v)
+		}
+	}
+	if !strings.HasSuffix(m["CODE_FILE"], "journald_linux_test.go") ||
+		m["CODE_LINE"] == "" || !strings.HasSuffix(m["CODE_FUNC"], ".TestJournal") {
+		t.Errorf("bad source: %q:%q %q", m["CODE_FILE"], m["CODE_LINE"], m["CODE_FUNC"])
+	}
+}
+
+func TestJournalLarge(t *testing.T) {
+	addr, c := listenJournal(t)
+	j, err := NewJournal(addr, "debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	l := NewLogger()
+	l.SetSinks(j)
+	big := strings.Repeat("x", 4<<20)
+	l.Warn("large", "data", big)
+
+	oob := make([]byte, syscall.CmsgSpace(4))
+	n, oobn, _, _, err := c.ReadMsgUnix(make([]byte, 16), oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("got %d bytes of data, want a file descriptor", n)
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("bad control message: %v", err)
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		t.Fatalf("bad rights: %v", err)
+	}
+	f := os.NewFile(uintptr(fds[0]), "journal")
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(io.NewSectionReader(f, 0, fi.Size()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := parseJournal(t, b)
+	if m["MESSAGE"] != "large" || m["DATA"] != big {
+		t.Errorf("bad entry: %q, %d bytes", m["MESSAGE"], len(m["DATA"]))
+	}
+}
+
+func TestJournalMissing(t *testing.T) {
+	_, err := NewJournal(filepath.Join(t.TempDir(), "none"), "debug")
+	if err != ErrOpenJournal {
+		t.Errorf("got %v, want %v", err, ErrOpenJournal)
+	}
+	if _, err := NewJournal("", "bad"); err != ErrInvLogLevel {
+		t.Errorf("got %v, want %v", err, ErrInvLogLevel)
+	}
+}
+
+func TestJournalResetOnError(t *testing.T) {
+	addr, c := listenJournal(t)
+	j, err := NewJournal(addr, "debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	l := NewLogger()
+	l.SetSinks(j)
+	l.Warn("small")
+	c.Close()
+	os.Remove(addr)
+
+	for _, msg := range []string{"small", strings.Repeat("x", 4<<20)} {
+		l.Warn(msg)
+		j.mu.Lock()
+		conn := j.conn
+		j.mu.Unlock()
+		if conn != nil {
+			t.Errorf("%d bytes: socket kept after failure", len(msg))
+		}
+	}
+}
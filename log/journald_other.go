@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+package log
+
+// journald is only available on linux
+type Journal struct {
+	Identifier string
+}
+
+func NewJournal(addr, min string) (*Journal, error) {
+	return nil, ErrOpenJournal
+}
+
+func (j *Journal) enabled(lvl level) bool {
+	return false
+}
+
+func (j *Journal) write(e *entry, _ *Format) {
+}
+
+func (j *Journal) Close() error {
+	return nil
+}
@@ -0,0 +1,83 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"time"
+)
+
+// names of levels in JSON, same as SetLevel accepts
+var levelName = map[level]string{
+	fatal: "fatal",
+	warn:  "warn",
+	info:  "info",
+	debug: "debug",
+}
+
+// keys used by the entry itself, fields with the same key are
+// renamed with prefix "fields."
+var reservedKeys = map[string]bool{
+	"time":   true,
+	"level":  true,
+	"msg":    true,
+	"caller": true,
+}
+
+// append entry e to b as a JSON object in one line, in the form of:
+//
+//	{"time":"...","level":"debug","msg":"...","caller":"a.go:12","key":"value"}
+//
+// time is in RFC 3339 with nanoseconds, omitted if f.TimeLayout is
+// empty or the time is zero. caller is only present in debug entries.
+func (f *Format) appendJSON(b []byte, e *entry) []byte {
+	b = append(b, '{')
+	if f.TimeLayout != "" && !e.time.IsZero() {
+		t := e.time
+		if f.UTC {
+			t = t.UTC()
+		}
+		b = append(b, `"time":"`...)
+		b = t.AppendFormat(b, time.RFC3339Nano)
+		b = append(b, `",`...)
+	}
+
+	b = append(b, `"level":`...)
+	b = strconv.AppendQuote(b, levelName[e.level])
+	b = append(b, `,"msg":`...)
+	b = appendJSONValue(b, e.msg)
+	if e.level == debug {
+		file, line := e.source()
+		b = append(b, `,"caller":`...)
+		b = appendJSONValue(b, fmt.Sprintf("%s:%d", path.Base(file), line))
+	}
+
+	for _, fd := range e.fields {
+		key := fd.key
+		if reservedKeys[key] {
+			key = "fields." + key
+		}
+		b = append(b, ',')
+		b = appendJSONValue(b, key)
+		b = append(b, ':')
+		b = appendJSONValue(b, fd.value)
+	}
+	return append(b, '}', '\n')
+}
+
+// errors are encoded as their messages, values json cannot encode as
+// their string form
+func appendJSONValue(b []byte, v interface{}) []byte {
+	if err, ok := v.(error); ok {
+		if _, ok := v.(json.Marshaler); !ok {
+			v = err.Error()
+		}
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(valueString(v))
+	}
+	return append(b, data...)
+}
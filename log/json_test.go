@@ -0,0 +1,79 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSON(t *testing.T) {
+	l, buf := bufLogger()
+	l.SetFormat(Format{Encoding: JSON, TimeLayout: time.RFC3339, UTC: true})
+
+	l.Info("hello \"world\"\n",
+		"time", 1, "level", 2, "msg", 3, "caller", 4,
+		"err", errors.New("boom"),
+		"inf", math.Inf(1),
+		"list", []int{1, 2},
+		"odd")
+	line := here() + 1
+	l.With("k", "v").Debug("d")
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want 2 lines, get: %q", lines)
+	}
+	var ms []map[string]interface{}
+	for _, s := range lines {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(s), &m); err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		ms = append(ms, m)
+	}
+
+	m := ms[0]
+	if _, err := time.Parse(time.RFC3339, m["time"].(string)); err != nil {
+		t.Errorf("time: %v", err)
+	}
+	want := map[string]interface{}{
+		"level":         "info",
+		"msg":           "hello \"world\"\n",
+		"fields.time":   1.0,
+		"fields.level":  2.0,
+		"fields.msg":    3.0,
+		"fields.caller": 4.0,
+		"err":           "boom",
+		"inf":           "+Inf",
+		badKey:          "odd",
+	}
+	for k, v := range want {
+		if m[k] != v {
+			t.Errorf("%s: want: %#v, get: %#v", k, v, m[k])
+		}
+	}
+	if l, ok := m["list"].([]interface{}); !ok || len(l) != 2 {
+		t.Errorf("list: get: %#v", m["list"])
+	}
+	if _, ok := m["caller"]; ok {
+		t.Errorf("caller in info entry: %v", m)
+	}
+
+	m = ms[1]
+	if c, _ := m["caller"].(string); c != "json_test.go:"+strconv.Itoa(line) || m["k"] != "v" || m["level"] != "debug" {
+		t.Errorf("get: %v", m)
+	}
+}
+
+func TestJSONNoTime(t *testing.T) {
+	l, buf := bufLogger()
+	l.SetFormat(Format{Encoding: JSON})
+	l.Warn("w")
+	if exp, out := `{"level":"warn","msg":"w"}`+"\n", buf.String(); out != exp {
+		t.Errorf("want: [%s], get: [%s]", exp, out)
+	}
+}
@@ -6,21 +6,39 @@
 //   2. combined the logf and log function. log for one argument, logf
 //      for multiple arguments.
 //   3. output source file and line number information in debug log.
+//   4. structured logging. Fatal/Warn/Info/Debug take a message and
+//      alternating keys and values, With() derives a logger adding
+//      fields to every entry. fields are rendered as key=value.
+//   5. log/slog bridge. NewHandler() makes a slog.Handler from a
+//      logger, UseHandler() makes a logger write to a slog.Handler.
+//   6. multiple destinations. SetOutput() and AddSink() send entries
+//      to writers, syslog or slog handlers, each with its own level.
+//      SetFormat() controls timestamp and prefix of text output,
+//      without sinks the flags of standard log package are used.
+//      NewFile() opens a log file rotated by size and/or age.
+//      NewRemoteSyslog() sends to syslog servers over the network.
+//      NewJournal() writes to systemd-journald(linux only).
+//   7. JSON output. set Encoding of Format to JSON for one object per
+//      line with time, level, msg, caller(debug only) and fields.
 //
 // Note:
 //   1. level supported: fatal, warn, info, debug(with source file
 //      information).
-//   2. syslog feature is not supported by windows.
+//   2. local syslog feature is not supported by windows.
 //
 package log
 
 import (
 	"errors"
 	"fmt"
+	"io"
 	olog "log"
+	"log/slog"
 	"path"
 	"runtime"
 	"strings"
+	"sync"
+	"time"
 )
 
 // general interface for basic logger
@@ -30,6 +48,11 @@ type Logger interface {
 	Warnf(format string, args ...interface{})
 	Infof(format string, args ...interface{})
 	Debugf(format string, args ...interface{})
+	Fatal(msg string, kv ...interface{})
+	Warn(msg string, kv ...interface{})
+	Info(msg string, kv ...interface{})
+	Debug(msg string, kv ...interface{})
+	With(kv ...interface{}) Logger
 }
 
 // interface used to extend the basic logger
@@ -37,6 +60,11 @@ type LoggerExtend interface {
 	Logger
 	IncNest(n int)
 	UseSyslog() error
+	UseHandler(h slog.Handler)
+	SetOutput(w io.Writer)
+	AddSink(s Sink)
+	SetSinks(s ...Sink)
+	SetFormat(f Format)
 }
 
 type level uint8
@@ -54,6 +82,7 @@ const defaultNest = 2
 var (
 	ErrInvLogLevel = errors.New("invalid log level")
 	ErrOpenSyslog  = errors.New("error open syslog for write")
+	ErrOpenJournal = errors.New("error open journal for write")
 )
 
 // mapping between numberic log level and their corresponding one
@@ -65,18 +94,29 @@ var levelStr = map[level]string{
 }
 
 type logger struct {
-	level     level
-	useSyslog bool
-	w         interface{} // syslog writer
-	nest      int         // call nest level
+	*state         // shared with derived loggers
+	nest   int     // call nest level
+	fields []field // added to every entry
+}
+
+// level and destination of a logger
+type state struct {
+	level level
+	w     interface{} // syslog writer of UseSyslog
+
+	mu     sync.RWMutex // protects fields below
+	sinks  []Sink       // standard log package if empty
+	format Format
 }
 
 // create a logger with different destination and/or log level
 func NewLogger() LoggerExtend {
 	return &logger{
-		level:     warn,
-		useSyslog: false,
-		nest:      defaultNest,
+		state: &state{
+			level:  warn,
+			format: DefaultFormat,
+		},
+		nest: defaultNest,
 	}
 }
 
@@ -125,6 +165,34 @@ func Debugf(format string, v ...interface{}) {
 	defaultLogger.Debugf(format, v...)
 }
 
+// log fatal message with key-value pairs for default logger
+func Fatal(msg string, kv ...interface{}) {
+	defaultLogger.Fatal(msg, kv...)
+}
+
+// log warning message with key-value pairs for default logger
+func Warn(msg string, kv ...interface{}) {
+	defaultLogger.Warn(msg, kv...)
+}
+
+// log info message with key-value pairs for default logger
+func Info(msg string, kv ...interface{}) {
+	defaultLogger.Info(msg, kv...)
+}
+
+// log debug message with key-value pairs for default logger
+func Debug(msg string, kv ...interface{}) {
+	defaultLogger.Debug(msg, kv...)
+}
+
+// derive a logger from default logger, see logger.With
+func With(kv ...interface{}) Logger {
+	l := defaultLogger.With(kv...).(*logger)
+	// called directly, not through the package functions
+	l.nest--
+	return l
+}
+
 // log fatal message
 func (l *logger) Fatalf(format string, v ...interface{}) {
 	l.log(fatal, format, v...)
@@ -145,46 +213,148 @@ func (l *logger) Debugf(format string, v ...interface{}) {
 	l.log(debug, format, v...)
 }
 
+// log fatal message with key-value pairs
+func (l *logger) Fatal(msg string, kv ...interface{}) {
+	l.logw(fatal, msg, kv)
+}
+
+// log warning message with key-value pairs
+func (l *logger) Warn(msg string, kv ...interface{}) {
+	l.logw(warn, msg, kv)
+}
+
+// log info message with key-value pairs
+func (l *logger) Info(msg string, kv ...interface{}) {
+	l.logw(info, msg, kv)
+}
+
+// log debug message with key-value pairs
+func (l *logger) Debug(msg string, kv ...interface{}) {
+	l.logw(debug, msg, kv)
+}
+
+// derive a logger adding the key-value pairs to every entry, after
+// the fields of l. level and destination are shared with l.
+func (l *logger) With(kv ...interface{}) Logger {
+	fs := make([]field, 0, len(l.fields)+len(kv)/2)
+	fs = append(fs, l.fields...)
+	return &logger{
+		state:  l.state,
+		nest:   l.nest,
+		fields: append(fs, toFields(kv)...),
+	}
+}
+
 func (l *logger) log(lvl level, format string, v ...interface{}) {
 	if lvl > l.level {
 		return
 	}
+	l.output(lvl, fmt.Sprintf(format, v...), nil)
+}
+
+func (l *logger) logw(lvl level, msg string, kv []interface{}) {
+	if lvl > l.level {
+		return
+	}
+	l.output(lvl, msg, kv)
+}
+
+// a log entry
+type entry struct {
+	time   time.Time
+	level  level
+	msg    string
+	fields []field
+	pc     uintptr // program counter of the caller, 0 if unknown
+}
+
+// source file and line number of the caller
+func (e *entry) source() (string, int) {
+	if e.pc == 0 {
+		return "???", 1
+	}
+	f, _ := runtime.CallersFrames([]uintptr{e.pc}).Next()
+	return f.File, f.Line
+}
+
+// build an entry with fields of l and kv. must be called from log or
+// logw.
+func (l *logger) output(lvl level, msg string, kv []interface{}) {
+	fs := l.fields
+	if len(kv) > 0 {
+		fs = append(fs[:len(fs):len(fs)], toFields(kv)...)
+	}
 
-	if l.useSyslog {
-		l.writeSyslog(lvl, format, v...)
-	} else {
-		var preamble string
-		if lvl == debug {
-			_, file, line, ok := runtime.Caller(l.nest)
-			if !ok {
-				file = "???"
-				line = 1
-			}
-			preamble = fmt.Sprintf("[%s %s:%d] ", levelStr[lvl],
-				path.Base(file), line)
-		} else {
-			preamble = fmt.Sprintf("[%s] ", levelStr[lvl])
+	e := entry{time: time.Now(), level: lvl, msg: msg, fields: fs}
+	if lvl == debug || l.hasSinks() {
+		var pcs [1]uintptr
+		if runtime.Callers(l.nest+2, pcs[:]) > 0 {
+			e.pc = pcs[0]
 		}
+	}
+	l.write(&e)
+}
 
-		olog.Printf(preamble+format, v...)
+// level, with source file and line number for debug entries
+func (e *entry) preamble() string {
+	if e.level == debug {
+		file, line := e.source()
+		return fmt.Sprintf("[%s %s:%d] ", levelStr[e.level],
+			path.Base(file), line)
 	}
+	return fmt.Sprintf("[%s] ", levelStr[e.level])
+}
+
+// write the entry to the sinks accepting its level, or the standard
+// log package if none. in the latter case, flags and prefix of the
+// standard log package apply instead of those of the format of l,
+// only the encoding is kept.
+func (l *logger) write(e *entry) {
+	l.mu.RLock()
+	sinks, f := l.sinks, l.format
+	l.mu.RUnlock()
+
+	if len(sinks) == 0 {
+		std := Format{Encoding: f.Encoding}
+		olog.Output(l.nest+3, string(std.appendLine(nil, e)))
+		return
+	}
+	for _, s := range sinks {
+		if s.enabled(e.level) {
+			s.write(e, &f)
+		}
+	}
+}
+
+func (l *logger) hasSinks() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.sinks) > 0
 }
 
 // set log level for logger l.
 //
 // lvl can be one of this: "debug", "info", "warn", "fatal"
 func (l *logger) SetLevel(lvl string) error {
+	v, err := parseLevel(lvl)
+	if err != nil {
+		return err
+	}
+	l.level = v
+	return nil
+}
+
+func parseLevel(lvl string) (level, error) {
 	switch strings.ToLower(lvl) {
 	case "fatal":
-		l.level = fatal
+		return fatal, nil
 	case "warn":
-		l.level = warn
+		return warn, nil
 	case "info":
-		l.level = info
+		return info, nil
 	case "debug":
-		l.level = debug
+		return debug, nil
 	default:
-		return ErrInvLogLevel
+		return none, ErrInvLogLevel
 	}
-	return nil
 }
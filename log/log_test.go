@@ -0,0 +1,208 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	olog "log"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// line number of the caller
+func here() int {
+	_, _, line, _ := runtime.Caller(1)
+	return line
+}
+
+func bufLogger() (LoggerExtend, *bytes.Buffer) {
+	var buf bytes.Buffer
+	l := NewLogger()
+	l.SetLevel("debug")
+	l.SetOutput(&buf)
+	l.SetFormat(Format{})
+	return l, &buf
+}
+
+// use default logger with output to a buffer during a test
+func bufDefault(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	SetLevel("debug")
+	SetOutput(&buf)
+	SetFormat(Format{})
+	t.Cleanup(func() {
+		SetLevel("warn")
+		SetSinks()
+		SetFormat(DefaultFormat)
+	})
+	return &buf
+}
+
+func TestWith(t *testing.T) {
+	l, buf := bufLogger()
+	a := l.With("a", 1)
+	b := a.With("b", "x y")
+	b.Info("msg", "c", 3)
+	a.Warn("msg")
+	l.Info("msg", "odd")
+	l.SetLevel("warn")
+	b.Info("hidden")
+
+	exp := "[INFO] msg a=1 b=\"x y\" c=3\n" +
+		"[WARN] msg a=1\n" +
+		"[INFO] msg !BADKEY=odd\n"
+	if out := buf.String(); out != exp {
+		t.Errorf("want: [%s]\nget: [%s]", exp, out)
+	}
+}
+
+func TestCaller(t *testing.T) {
+	l, buf := bufLogger()
+	line := here() + 1
+	l.Debug("m", "k", 1)
+	exp := fmt.Sprintf("[DBUG log_test.go:%d] m k=1\n", line)
+	if out := buf.String(); out != exp {
+		t.Errorf("logger, want: [%s], get: [%s]", exp, out)
+	}
+
+	buf.Reset()
+	line = here() + 1
+	l.With("k", 1).Debugf("m")
+	exp = fmt.Sprintf("[DBUG log_test.go:%d] m k=1\n", line)
+	if out := buf.String(); out != exp {
+		t.Errorf("derived, want: [%s], get: [%s]", exp, out)
+	}
+
+	buf = bufDefault(t)
+	line = here() + 1
+	Debug("m")
+	Debugf("m")
+	With("k", 1).Debug("m")
+	exp = fmt.Sprintf("[DBUG log_test.go:%d] m\n[DBUG log_test.go:%d] m\n"+
+		"[DBUG log_test.go:%d] m k=1\n", line, line+1, line+2)
+	if out := buf.String(); out != exp {
+		t.Errorf("default, want: [%s], get: [%s]", exp, out)
+	}
+
+	// only debug entries have the caller
+	buf.Reset()
+	With("k", 1).Info("m")
+	if out := buf.String(); strings.Contains(out, ".go:") {
+		t.Errorf("get: [%s]", out)
+	}
+}
+
+func TestSinks(t *testing.T) {
+	var file, stderr bytes.Buffer
+	l := NewLogger()
+	l.SetLevel("debug")
+	l.SetFormat(Format{})
+	l.SetOutput(&file)
+	s, err := NewWriterSink(&stderr, "warn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.AddSink(s)
+
+	l.Debugf("d")
+	l.Info("i")
+	l.Warn("w")
+	l.Fatal("f")
+
+	if out := file.String(); strings.Count(out, "\n") != 4 || !strings.HasPrefix(out, "[DBUG log_test.go:") {
+		t.Errorf("file, get: [%s]", out)
+	}
+	if exp, out := "[WARN] w\n[FATL] f\n", stderr.String(); out != exp {
+		t.Errorf("stderr, want: [%s], get: [%s]", exp, out)
+	}
+
+	// the level of logger applies before sinks
+	l.SetLevel("fatal")
+	l.Warn("hidden")
+	if strings.Contains(file.String()+stderr.String(), "hidden") {
+		t.Error("entry below level written")
+	}
+
+	if _, err := NewWriterSink(&stderr, "bad"); err != ErrInvLogLevel {
+		t.Errorf("want: %v, get: %v", ErrInvLogLevel, err)
+	}
+}
+
+func TestSetFormat(t *testing.T) {
+	l, buf := bufLogger()
+	l.SetFormat(Format{Prefix: "app: ", TimeLayout: "Z07:00 ", UTC: true})
+	l.Info("m", "k", 1)
+	if exp, out := "app: Z  [INFO] m k=1\n", buf.String(); out != exp {
+		t.Errorf("want: [%s], get: [%s]", exp, out)
+	}
+
+	// without sinks, the standard log package adds its prefix and
+	// flags, only the encoding applies
+	var std bytes.Buffer
+	olog.SetOutput(&std)
+	olog.SetFlags(0)
+	olog.SetPrefix("std: ")
+	defer func() {
+		olog.SetOutput(os.Stderr)
+		olog.SetFlags(olog.LstdFlags)
+		olog.SetPrefix("")
+	}()
+	l.SetSinks()
+	l.Info("m", "k", 1)
+	if exp, out := "std: [INFO] m k=1\n", std.String(); out != exp {
+		t.Errorf("no sink, want: [%s], get: [%s]", exp, out)
+	}
+
+	std.Reset()
+	l.SetFormat(Format{Encoding: JSON, TimeLayout: time.RFC3339})
+	l.Info("m")
+	if exp, out := `std: {"level":"info","msg":"m"}`+"\n", std.String(); out != exp {
+		t.Errorf("no sink, want: [%s], get: [%s]", exp, out)
+	}
+
+	std.Reset()
+	l.SetFormat(Format{})
+	olog.SetFlags(olog.Lshortfile)
+	line := here() + 1
+	l.Info("m")
+	Warn("m")
+	exp := fmt.Sprintf("std: log_test.go:%d: [INFO] m\nstd: log_test.go:%d: [WARN] m\n", line, line+1)
+	if out := std.String(); out != exp {
+		t.Errorf("no sink, want: [%s], get: [%s]", exp, out)
+	}
+}
+
+func TestNoSinkConcurrent(t *testing.T) {
+	var std bytes.Buffer
+	olog.SetOutput(&std)
+	olog.SetFlags(0)
+	defer func() {
+		olog.SetOutput(os.Stderr)
+		olog.SetFlags(olog.LstdFlags)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		l := NewLogger()
+		l.SetLevel("info")
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				l.Info("m", "i", i)
+				olog.Print("std")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := strings.Count(std.String(), "[INFO] m i="); n != 800 {
+		t.Errorf("want: 800 entries, get: %d", n)
+	}
+	if n := strings.Count(std.String(), "\n"); n != 1600 {
+		t.Errorf("want: 1600 lines, get: %d", n)
+	}
+}
@@ -0,0 +1,396 @@
+package log
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syslog facility
+type Facility uint8
+
+const (
+	FacKern Facility = iota
+	FacUser
+	FacMail
+	FacDaemon
+	FacAuth
+	FacSyslog
+	FacLpr
+	FacNews
+	FacUucp
+	FacCron
+	FacAuthpriv
+	FacFTP
+	_
+	_
+	_
+	_
+	FacLocal0
+	FacLocal1
+	FacLocal2
+	FacLocal3
+	FacLocal4
+	FacLocal5
+	FacLocal6
+	FacLocal7
+)
+
+// syslog severity of levels
+var severity = map[level]int{
+	fatal: 2, // critical
+	warn:  4, // warning
+	info:  6, // informational
+	debug: 7, // debug
+}
+
+var ErrNetwork = errors.New("unsupported network")
+
+// minimal interval between connection attempts
+const minRetry = 10 * time.Millisecond
+
+// RemoteSyslog is a sink sending entries to a syslog server over UDP,
+// TCP or unix sockets, in RFC 5424 or RFC 3164 format. On stream
+// connections messages are framed by octet counting (RFC 6587).
+//
+// Entries are queued in a bounded buffer, the oldest dropped if full,
+// and sent in order by a background goroutine, so logging never
+// waits for the server. The goroutine is started by the first entry,
+// and connects again every Retry while the server is down.
+//
+// Settings must not be changed after the first entry.
+type RemoteSyslog struct {
+	Facility Facility // FacUser by default
+	Tag      string   // APP-NAME, base name of the program by default
+	Hostname string   // os.Hostname() by default
+	RFC3164  bool     // use BSD format instead of RFC 5424
+	// SDID, if not empty, is the SD-ID of RFC 5424 structured data
+	// carrying the fields, e.g. "fields@32473". Fields are appended
+	// to the message otherwise.
+	SDID string
+	// Buffer is the maximal number of entries waiting to be sent, at
+	// least 1.
+	Buffer int
+	// Retry is the interval between connection attempts, at least
+	// 10ms.
+	Retry time.Duration
+	// Timeout of connecting and writing, also of sending the queued
+	// entries by Close.
+	Timeout time.Duration
+
+	network string
+	addr    string
+	min     level
+	stream  bool
+
+	mu      sync.Mutex // protects fields below
+	queue   [][]byte
+	dropped uint64
+	kick    chan struct{} // wakes up the sender, nil if not running
+	quit    chan struct{}
+	done    chan struct{}
+
+	sender  sync.Mutex // serializes sending, protects fields below
+	conn    net.Conn
+	last    time.Time // of the last connection attempt
+	pending []byte    // taken from queue but not sent yet
+}
+
+// create a sink sending entries at level min or above to the syslog
+// server at addr. network is one of "udp", "tcp", "unix" and
+// "unixgram".
+func NewRemoteSyslog(network, addr, min string) (*RemoteSyslog, error) {
+	lvl, err := parseLevel(min)
+	if err != nil {
+		return nil, err
+	}
+
+	var stream bool
+	switch network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		stream = true
+	case "udp", "udp4", "udp6", "unixgram":
+	default:
+		return nil, ErrNetwork
+	}
+
+	host, _ := os.Hostname()
+	return &RemoteSyslog{
+		Facility: FacUser,
+		Tag:      path.Base(os.Args[0]),
+		Hostname: host,
+		Buffer:   1000,
+		Retry:    time.Second,
+		Timeout:  5 * time.Second,
+		network:  network,
+		addr:     addr,
+		min:      lvl,
+		stream:   stream,
+	}, nil
+}
+
+func (s *RemoteSyslog) enabled(lvl level) bool {
+	return lvl <= s.min
+}
+
+// queue the entry and wake up the sender
+func (s *RemoteSyslog) write(e *entry, _ *Format) {
+	msg := s.format(e)
+	if s.stream {
+		msg = append(append(strconv.AppendInt(nil, int64(len(msg)), 10), ' '), msg...)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queue = append(s.queue, msg)
+	// keep the newest entries left
+	if n := len(s.queue) - max(s.Buffer, 1); n > 0 {
+		for i := 0; i < n; i++ {
+			s.queue[i] = nil
+		}
+		s.queue = s.queue[n:]
+		s.dropped += uint64(n)
+	}
+
+	if s.kick == nil {
+		s.kick = make(chan struct{}, 1)
+		s.quit = make(chan struct{})
+		s.done = make(chan struct{})
+		go s.run(s.kick, s.quit, s.done)
+	}
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+}
+
+// number of entries dropped as the buffer was full
+func (s *RemoteSyslog) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// send the queued entries now, connecting if needed regardless of
+// Retry. it waits for the sender.
+func (s *RemoteSyslog) Flush() error {
+	s.sender.Lock()
+	defer s.sender.Unlock()
+	s.last = time.Time{}
+	return s.flush(time.Time{})
+}
+
+// stop the sender, send the queued entries within Timeout and close
+// the connection. entries failed to send are kept and sent after the
+// next entry.
+func (s *RemoteSyslog) Close() error {
+	s.mu.Lock()
+	quit, done := s.quit, s.done
+	s.kick, s.quit, s.done = nil, nil, nil
+	s.mu.Unlock()
+
+	if quit != nil {
+		close(quit)
+		<-done
+	}
+
+	s.sender.Lock()
+	defer s.sender.Unlock()
+
+	var end time.Time
+	if s.Timeout > 0 {
+		end = time.Now().Add(s.Timeout)
+	}
+	s.last = time.Time{}
+	err := s.flush(end)
+	if s.conn != nil {
+		if cerr := s.conn.Close(); err == nil {
+			err = cerr
+		}
+		s.conn = nil
+	}
+	return err
+}
+
+// the sender, it sends the queue when kicked, and retries while not
+// all sent
+func (s *RemoteSyslog) run(kick, quit, done chan struct{}) {
+	defer close(done)
+
+	var retry <-chan time.Time
+	for {
+		select {
+		case <-kick:
+		case <-retry:
+		case <-quit:
+			return
+		}
+
+		s.sender.Lock()
+		s.flush(time.Time{})
+		left := s.pending != nil
+		s.sender.Unlock()
+
+		s.mu.Lock()
+		left = left || len(s.queue) > 0
+		s.mu.Unlock()
+
+		retry = nil
+		if left {
+			retry = time.After(max(s.Retry, minRetry))
+		}
+	}
+}
+
+// send the queued entries, connecting at most every Retry. each
+// operation is bounded by Timeout, and all of them by end if not
+// zero. must be called with s.sender held.
+func (s *RemoteSyslog) flush(end time.Time) error {
+	deadline := func() time.Time {
+		if !end.IsZero() || s.Timeout <= 0 {
+			return end
+		}
+		return time.Now().Add(s.Timeout)
+	}
+
+	for {
+		if s.pending == nil {
+			s.mu.Lock()
+			empty := len(s.queue) == 0
+			s.mu.Unlock()
+			if empty {
+				return nil
+			}
+		}
+
+		// entries are kept in the queue until connected, so Buffer
+		// applies while disconnected
+		if s.conn == nil {
+			if time.Since(s.last) < max(s.Retry, minRetry) {
+				return nil
+			}
+			s.last = time.Now()
+			d := net.Dialer{Deadline: deadline()}
+			c, err := d.Dial(s.network, s.addr)
+			if err != nil {
+				return err
+			}
+			s.conn = c
+		}
+
+		if s.pending == nil {
+			s.mu.Lock()
+			if len(s.queue) == 0 {
+				s.mu.Unlock()
+				return nil
+			}
+			s.pending = s.queue[0]
+			s.queue[0] = nil
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+		}
+
+		s.conn.SetWriteDeadline(deadline())
+		if _, err := s.conn.Write(s.pending); err != nil {
+			// retry the entry on the next connection
+			s.conn.Close()
+			s.conn = nil
+			return err
+		}
+		s.pending = nil
+	}
+}
+
+// render entry e as a syslog message
+func (s *RemoteSyslog) format(e *entry) []byte {
+	pri := int(s.Facility)*8 + severity[e.level]
+	b := append([]byte{'<'}, strconv.Itoa(pri)...)
+	b = append(b, '>')
+	tag := orNil(s.Tag)
+	host := orNil(s.Hostname)
+	pid := os.Getpid()
+
+	if s.RFC3164 {
+		// the timestamp is mandatory, zero time of a slog.Record is
+		// replaced
+		t := e.time
+		if t.IsZero() {
+			t = time.Now()
+		}
+		b = t.AppendFormat(b, time.Stamp)
+		b = append(b, ' ')
+		b = append(b, host...)
+		b = append(b, ' ')
+		b = append(b, tag...)
+		b = append(b, '[')
+		b = strconv.AppendInt(b, int64(pid), 10)
+		b = append(b, "]: "...)
+		return append(b, formatText(e.msg, e.fields)...)
+	}
+
+	b = append(b, "1 "...)
+	if e.time.IsZero() {
+		b = append(b, '-')
+	} else {
+		b = e.time.AppendFormat(b, "2006-01-02T15:04:05.000000Z07:00")
+	}
+	b = append(b, ' ')
+	b = append(b, host...)
+	b = append(b, ' ')
+	b = append(b, tag...)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(pid), 10)
+	b = append(b, " - "...)
+
+	if s.SDID == "" || len(e.fields) == 0 {
+		b = append(b, "- "...)
+		return append(b, formatText(e.msg, e.fields)...)
+	}
+
+	b = append(b, '[')
+	b = append(b, s.SDID...)
+	for _, f := range e.fields {
+		b = append(b, ' ')
+		b = append(b, sdName(f.key)...)
+		b = append(b, `="`...)
+		b = append(b, sdEscape.Replace(valueString(f.value))...)
+		b = append(b, '"')
+	}
+	b = append(b, "] "...)
+	return append(b, e.msg...)
+}
+
+// nil value of header fields of RFC 5424
+func orNil(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// escape of PARAM-VALUE in structured data
+var sdEscape = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+// convert a field key into a valid PARAM-NAME: at most 32 printable
+// ASCII characters except '=', ' ', ']' and '"'
+func sdName(k string) string {
+	b := []byte(k)
+	if len(b) > 32 {
+		b = b[:32]
+	}
+	for i, c := range b {
+		if c <= ' ' || c >= 127 || c == '=' || c == ']' || c == '"' {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 {
+		return "_"
+	}
+	return string(b)
+}
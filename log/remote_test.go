@@ -0,0 +1,290 @@
+package log
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func remoteLogger(t *testing.T, network, addr string) (LoggerExtend, *RemoteSyslog) {
+	s, err := NewRemoteSyslog(network, addr, "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Tag = "app"
+	s.Hostname = "host"
+	s.Retry = 0
+	s.Timeout = time.Second
+
+	l := NewLogger()
+	l.SetLevel("debug")
+	l.SetSinks(s)
+	return l, s
+}
+
+func TestRemoteSyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	l, s := remoteLogger(t, "udp", pc.LocalAddr().String())
+	s.SDID = "fields@32473"
+	s.Facility = FacLocal0
+	l.Debug("hidden")
+	l.With("k", `v "q"]`).Warn("hello", "bad key", 1)
+
+	buf := make([]byte, 1024)
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := string(buf[:n])
+	head := "<132>1 "
+	tail := ` host app ` + strconv.Itoa(os.Getpid()) +
+		` - [fields@32473 k="v \"q\"\]" bad_key="1"] hello`
+	if !strings.HasPrefix(msg, head) || !strings.HasSuffix(msg, tail) {
+		t.Errorf("want: [%s...%s], get: [%s]", head, tail, msg)
+	}
+}
+
+func TestRemoteSyslogUnixgram(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "log.sock")
+	pc, err := net.ListenPacket("unixgram", addr)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer pc.Close()
+
+	l, s := remoteLogger(t, "unixgram", addr)
+	s.RFC3164 = true
+	l.Info("hello", "k", "v")
+
+	buf := make([]byte, 1024)
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := string(buf[:n])
+	tail := " host app[" + strconv.Itoa(os.Getpid()) + "]: hello k=v"
+	if !strings.HasPrefix(msg, "<14>") || !strings.HasSuffix(msg, tail) {
+		t.Errorf("want: [<14>...%s], get: [%s]", tail, msg)
+	}
+}
+
+// read octet counting framed messages from the first connection
+func readFramed(ln net.Listener, n int) chan []string {
+	ch := make(chan []string, 1)
+	go func() {
+		var msgs []string
+		defer func() { ch <- msgs }()
+
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+		r := bufio.NewReader(c)
+		for len(msgs) < n {
+			head, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			size, _ := strconv.Atoi(strings.TrimSpace(head))
+			b := make([]byte, size)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return
+			}
+			msgs = append(msgs, string(b))
+		}
+	}()
+	return ch
+}
+
+func TestRemoteSyslogTCPReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	l, s := remoteLogger(t, "tcp", addr)
+	s.Buffer = 2
+	for i := 1; i <= 3; i++ {
+		l.Infof("buffered %d", i)
+	}
+	if d := s.Dropped(); d != 1 {
+		t.Errorf("want: 1 dropped, get: %d", d)
+	}
+
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	ch := readFramed(ln, 3)
+	defer s.Close()
+	// sent before the next entry, which would drop one more
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	l.Info("connected")
+
+	msgs := <-ch
+	exp := []string{"buffered 2", "buffered 3", "connected"}
+	if len(msgs) != len(exp) {
+		t.Fatalf("want: %v, get: %v", exp, msgs)
+	}
+	for i := range exp {
+		if !strings.HasSuffix(msgs[i], " - - "+exp[i]) {
+			t.Errorf("want: [...%s], get: [%s]", exp[i], msgs[i])
+		}
+	}
+}
+
+func TestRemoteSyslogNetwork(t *testing.T) {
+	if _, err := NewRemoteSyslog("ip", "127.0.0.1", "info"); err != ErrNetwork {
+		t.Errorf("want:[%v], get:[%v]", ErrNetwork, err)
+	}
+}
+
+func TestRemoteSyslogRetryQuiet(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	l, s := remoteLogger(t, "tcp", addr)
+	defer s.Close()
+	l.Info("while down")
+	time.Sleep(20 * time.Millisecond)
+
+	// delivered without further entries
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	msgs := <-readFramed(ln, 1)
+	if len(msgs) != 1 || !strings.HasSuffix(msgs[0], " - - while down") {
+		t.Errorf("get: %v", msgs)
+	}
+}
+
+func TestRemoteSyslogNonBlocking(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	l, s := remoteLogger(t, "udp", pc.LocalAddr().String())
+	defer s.Close()
+	s.Buffer = 2
+
+	// a sender stuck on a slow server
+	s.sender.Lock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			l.Infof("entry %d", i)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("logging blocked by the sender")
+	}
+	s.sender.Unlock()
+
+	if d := s.Dropped(); d != 3 {
+		t.Errorf("want: 3 dropped, get: %d", d)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1024)
+	var got []string
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	for len(got) < 2 {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(buf[:n]))
+	}
+	if !strings.HasSuffix(got[0], "entry 3") || !strings.HasSuffix(got[1], "entry 4") {
+		t.Errorf("get: %q", got)
+	}
+}
+
+func TestRemoteSyslogCloseFlush(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	// the sender gives up until Close
+	l, s := remoteLogger(t, "tcp", addr)
+	s.Retry = time.Hour
+	l.Info("while down")
+	time.Sleep(20 * time.Millisecond)
+
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	ch := readFramed(ln, 1)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := <-ch; len(msgs) != 1 || !strings.HasSuffix(msgs[0], " - - while down") {
+		t.Errorf("get: %v", msgs)
+	}
+}
+
+func TestRemoteSyslogZeroTime(t *testing.T) {
+	s, err := NewRemoteSyslog("udp", "127.0.0.1:514", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Tag = "app"
+	s.Hostname = "host"
+	e := &entry{level: info, msg: "m"}
+
+	exp := "<14>1 - host app " + strconv.Itoa(os.Getpid()) + " - - m"
+	if out := string(s.format(e)); out != exp {
+		t.Errorf("want: [%s], get: [%s]", exp, out)
+	}
+
+	s.RFC3164 = true
+	out := string(s.format(e))
+	stamp := strings.TrimSuffix(strings.TrimPrefix(out, "<14>"), " host app["+strconv.Itoa(os.Getpid())+"]: m")
+	now := time.Now()
+	ts, err := time.ParseInLocation(time.Stamp, stamp, time.Local)
+	ts = ts.AddDate(now.Year(), 0, 0)
+	if err != nil || now.Sub(ts) > time.Minute || ts.Sub(now) > time.Minute {
+		t.Errorf("want current time, get: [%s]", out)
+	}
+}
@@ -0,0 +1,140 @@
+package log
+
+import (
+	"io"
+	"sync"
+)
+
+// destination of log entries, created by NewWriterSink,
+// NewSyslogSink or NewHandlerSink
+type Sink interface {
+	// whether entries of level lvl are accepted
+	enabled(lvl level) bool
+	// write an entry, f is the format of the logger
+	write(e *entry, f *Format)
+}
+
+// encoding of entries written by sinks
+type Encoding uint8
+
+const (
+	Text Encoding = iota // "[LEVEL] message key=value"
+	JSON                 // one JSON object per line
+)
+
+// format of entries written by a logger. without sinks, entries go
+// to the standard log package, which adds prefix and timestamp by its
+// own flags, only Encoding applies.
+type Format struct {
+	Encoding   Encoding
+	Prefix     string // written at the beginning of every text line
+	TimeLayout string // layout of timestamp in time.Format, empty for none
+	UTC        bool   // use UTC instead of local time in timestamp
+}
+
+// same look as the standard log package
+var DefaultFormat = Format{TimeLayout: "2006/01/02 15:04:05"}
+
+// append the line of entry e to b in the encoding of f
+func (f *Format) appendLine(b []byte, e *entry) []byte {
+	if f.Encoding == JSON {
+		return f.appendJSON(b, e)
+	}
+	return f.appendText(b, e)
+}
+
+// append the text line of entry e to b
+func (f *Format) appendText(b []byte, e *entry) []byte {
+	b = append(b, f.Prefix...)
+	// zero time, e.g. from a slog.Record, is omitted
+	if f.TimeLayout != "" && !e.time.IsZero() {
+		t := e.time
+		if f.UTC {
+			t = t.UTC()
+		}
+		b = t.AppendFormat(b, f.TimeLayout)
+		b = append(b, ' ')
+	}
+	b = append(b, e.preamble()...)
+	b = append(b, formatText(e.msg, e.fields)...)
+	return append(b, '\n')
+}
+
+// writerSink writes entries as lines of text to a writer
+type writerSink struct {
+	min level
+	mu  sync.Mutex // serializes writes
+	w   io.Writer
+	buf []byte
+}
+
+// create a sink writing entries at level min or above to w, one line
+// each
+func NewWriterSink(w io.Writer, min string) (Sink, error) {
+	lvl, err := parseLevel(min)
+	if err != nil {
+		return nil, err
+	}
+	return &writerSink{min: lvl, w: w}, nil
+}
+
+func (s *writerSink) enabled(lvl level) bool {
+	return lvl <= s.min
+}
+
+func (s *writerSink) write(e *entry, f *Format) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf = f.appendLine(s.buf[:0], e)
+	s.w.Write(s.buf)
+}
+
+// write all entries of logger l to w only. level control of l still
+// applies.
+func (l *logger) SetOutput(w io.Writer) {
+	l.SetSinks(&writerSink{min: debug, w: w})
+}
+
+// add a destination to logger l, entries are written to all the
+// sinks accepting their level. if l had no sink, the standard log
+// package is no longer used.
+func (l *logger) AddSink(s Sink) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sinks = append(l.sinks[:len(l.sinks):len(l.sinks)], s)
+}
+
+// replace all the destinations of logger l, entries go to the
+// standard log package if none
+func (l *logger) SetSinks(s ...Sink) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sinks = append([]Sink(nil), s...)
+}
+
+// set the format of entries written by logger l
+func (l *logger) SetFormat(f Format) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.format = f
+}
+
+// write all entries of default logger to w only
+func SetOutput(w io.Writer) {
+	defaultLogger.SetOutput(w)
+}
+
+// add a destination to default logger, see logger.AddSink
+func AddSink(s Sink) {
+	defaultLogger.AddSink(s)
+}
+
+// replace all the destinations of default logger
+func SetSinks(s ...Sink) {
+	defaultLogger.SetSinks(s...)
+}
+
+// set the format of entries written by default logger
+func SetFormat(f Format) {
+	defaultLogger.SetFormat(f)
+}
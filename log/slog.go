@@ -0,0 +1,164 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+)
+
+// map slog levels to ours, levels above error are fatal
+func fromSlog(l slog.Level) level {
+	switch {
+	case l >= slog.LevelError:
+		return fatal
+	case l >= slog.LevelWarn:
+		return warn
+	case l >= slog.LevelInfo:
+		return info
+	default:
+		return debug
+	}
+}
+
+func toSlog(l level) slog.Level {
+	switch l {
+	case fatal:
+		return slog.LevelError
+	case warn:
+		return slog.LevelWarn
+	case info:
+		return slog.LevelInfo
+	default:
+		return slog.LevelDebug
+	}
+}
+
+// handler is a slog.Handler writing to a logger
+type handler struct {
+	l     *logger
+	group string // prefix of keys, ends with "." if not empty
+}
+
+// create a slog.Handler writing through l, with its level and
+// destination. slog levels are mapped to debug, info, warn and
+// fatal(error and above). l must be created by this package.
+//
+// Note: l must not write to this handler, see UseHandler.
+func NewHandler(l Logger) slog.Handler {
+	ll, ok := l.(*logger)
+	if !ok {
+		panic("log: logger not created by this package")
+	}
+	return &handler{l: ll}
+}
+
+// create a slog.Handler writing through default logger
+func DefaultHandler() slog.Handler {
+	return NewHandler(defaultLogger)
+}
+
+func (h *handler) Enabled(_ context.Context, l slog.Level) bool {
+	return fromSlog(l) <= h.l.level
+}
+
+func (h *handler) Handle(_ context.Context, r slog.Record) error {
+	lvl := fromSlog(r.Level)
+	if lvl > h.l.level {
+		return nil
+	}
+
+	fs := h.l.fields[:len(h.l.fields):len(h.l.fields)]
+	r.Attrs(func(a slog.Attr) bool {
+		fs = appendAttr(fs, h.group, a)
+		return true
+	})
+	h.l.write(&entry{time: r.Time, level: lvl, msg: r.Message, fields: fs, pc: r.PC})
+	return nil
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fs := make([]field, 0, len(h.l.fields)+len(attrs))
+	fs = append(fs, h.l.fields...)
+	for _, a := range attrs {
+		fs = appendAttr(fs, h.group, a)
+	}
+	return &handler{
+		l:     &logger{state: h.l.state, nest: h.l.nest, fields: fs},
+		group: h.group,
+	}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &handler{l: h.l, group: h.group + name + "."}
+}
+
+// convert an attribute into fields, groups are flattened into keys
+// joined with "."
+func appendAttr(fs []field, prefix string, a slog.Attr) []field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fs
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			fs = appendAttr(fs, prefix, ga)
+		}
+		return fs
+	}
+	return append(fs, field{prefix + a.Key, a.Value.Any()})
+}
+
+// write entries of logger l through h instead of other sinks, nil
+// to stop. level control of l still applies before h. derived
+// loggers share the handler. see also NewHandlerSink.
+func (l *logger) UseHandler(h slog.Handler) {
+	if h == nil {
+		l.SetSinks()
+		return
+	}
+	l.SetSinks(&handlerSink{h: h, min: debug})
+}
+
+// write entries of default logger through h, see logger.UseHandler
+func UseHandler(h slog.Handler) {
+	defaultLogger.UseHandler(h)
+}
+
+// handlerSink writes entries to a slog.Handler
+type handlerSink struct {
+	h   slog.Handler
+	min level
+}
+
+// create a sink writing entries at level min or above to h
+func NewHandlerSink(h slog.Handler, min string) (Sink, error) {
+	lvl, err := parseLevel(min)
+	if err != nil {
+		return nil, err
+	}
+	return &handlerSink{h: h, min: lvl}, nil
+}
+
+func (s *handlerSink) enabled(lvl level) bool {
+	return lvl <= s.min
+}
+
+func (s *handlerSink) write(e *entry, _ *Format) {
+	ctx := context.Background()
+	lvl := toSlog(e.level)
+	if !s.h.Enabled(ctx, lvl) {
+		return
+	}
+
+	r := slog.NewRecord(e.time, lvl, e.msg, e.pc)
+	for _, f := range e.fields {
+		r.AddAttrs(slog.Any(f.key, f.value))
+	}
+	s.h.Handle(ctx, r)
+}
@@ -0,0 +1,128 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"testing/slogtest"
+	"time"
+)
+
+// parse JSON lines, keys flattened by the handler are nested again
+func parseJSONLines(t *testing.T, b []byte) []map[string]any {
+	t.Helper()
+	var ms []map[string]any
+	for _, line := range bytes.Split(bytes.TrimSpace(b), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var flat map[string]any
+		if err := json.Unmarshal(line, &flat); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		m := make(map[string]any)
+		for k, v := range flat {
+			cur := m
+			keys := strings.Split(k, ".")
+			for _, g := range keys[:len(keys)-1] {
+				sub, ok := cur[g].(map[string]any)
+				if !ok {
+					sub = make(map[string]any)
+					cur[g] = sub
+				}
+				cur = sub
+			}
+			cur[keys[len(keys)-1]] = v
+		}
+		ms = append(ms, m)
+	}
+	return ms
+}
+
+func TestHandlerContract(t *testing.T) {
+	l, buf := bufLogger()
+	l.SetFormat(Format{Encoding: JSON, TimeLayout: time.RFC3339})
+	h := NewHandler(l)
+
+	err := slogtest.TestHandler(h, func() []map[string]any {
+		return parseJSONLines(t, buf.Bytes())
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHandlerText(t *testing.T) {
+	l, buf := bufLogger()
+	l.SetLevel("info")
+	l.SetFormat(Format{TimeLayout: "2006"})
+	lg := slog.New(NewHandler(l.With("a", 1)))
+
+	lg.Debug("hidden")
+	lg.WithGroup("g").With("b", 2).Error("m", slog.Group("h", "c", 3))
+	lg.Handler().Handle(context.Background(), slog.NewRecord(time.Time{}, slog.LevelWarn, "zero", 0))
+
+	// zero time is omitted
+	lines := strings.Split(buf.String(), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[0], " [FATL] m a=1 g.b=2 g.h.c=3") ||
+		lines[1] != "[WARN] zero a=1" {
+		t.Errorf("get: %q", lines)
+	}
+}
+
+func TestUseHandler(t *testing.T) {
+	var buf bytes.Buffer
+	h := slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+
+	l := NewLogger()
+	l.SetLevel("info")
+	l.UseHandler(h)
+	l.Debug("hidden")
+	l.Info("i")
+	l.Warn("w", "k", 1)
+	l.Fatal("f")
+
+	ms := parseJSONLines(t, buf.Bytes())
+	want := []string{"INFO", "WARN", "ERROR"}
+	if len(ms) != len(want) {
+		t.Fatalf("want %d entries, get: %s", len(want), buf.String())
+	}
+	for i, m := range ms {
+		if m["level"] != want[i] {
+			t.Errorf("entry %d: want level %s, get: %v", i, want[i], m["level"])
+		}
+	}
+	if ms[1]["k"] != 1.0 {
+		t.Errorf("get: %v", ms[1])
+	}
+
+	// per sink level
+	buf.Reset()
+	s, err := NewHandlerSink(h, "warn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.SetLevel("debug")
+	l.SetSinks(s)
+	l.Debug("d")
+	l.Info("i")
+	l.Warn("w")
+	if ms := parseJSONLines(t, buf.Bytes()); len(ms) != 1 || ms[0]["msg"] != "w" {
+		t.Errorf("get: %s", buf.String())
+	}
+	if _, err := NewHandlerSink(h, "bad"); err != ErrInvLogLevel {
+		t.Errorf("want: %v, get: %v", ErrInvLogLevel, err)
+	}
+
+	// handler levels are still checked
+	buf.Reset()
+	l.UseHandler(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	l.Info("i")
+	l.Warn("w")
+	if ms := parseJSONLines(t, buf.Bytes()); len(ms) != 1 || ms[0]["level"] != "WARN" {
+		t.Errorf("get: %s", buf.String())
+	}
+}
@@ -12,30 +12,62 @@ import (
 // write log to syslog with default settings:
 //   syslog.LOG_INFO|syslog.LOG_USER
 func (l *logger) UseSyslog() error {
-	l.useSyslog = true
 	if l.w == nil {
-		w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_USER,
-			fmt.Sprintf("%s", path.Base(os.Args[0])))
+		w, err := openSyslog()
 		if err != nil {
-			return ErrOpenSyslog
+			return err
 		}
 		l.w = w
 	}
+	l.SetSinks(&syslogSink{min: debug, w: l.w.(*syslog.Writer)})
 	return nil
 }
 
-func (l *logger) writeSyslog(lvl level, format string, v ...interface{}) {
-	msg := fmt.Sprintf(format, v...)
+func openSyslog() (*syslog.Writer, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_USER,
+		fmt.Sprintf("%s", path.Base(os.Args[0])))
+	if err != nil {
+		return nil, ErrOpenSyslog
+	}
+	return w, nil
+}
+
+// syslogSink writes entries to local syslog
+type syslogSink struct {
+	min level
+	w   *syslog.Writer
+}
+
+// create a sink writing entries at level min or above to local
+// syslog, with default settings as UseSyslog
+func NewSyslogSink(min string) (Sink, error) {
+	lvl, err := parseLevel(min)
+	if err != nil {
+		return nil, err
+	}
+	w, err := openSyslog()
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{min: lvl, w: w}, nil
+}
+
+func (s *syslogSink) enabled(lvl level) bool {
+	return lvl <= s.min
+}
+
+func (s *syslogSink) write(e *entry, _ *Format) {
+	msg := formatText(e.msg, e.fields)
 
-	switch lvl {
+	switch e.level {
 	case fatal:
-		l.w.(*syslog.Writer).Crit(msg)
+		s.w.Crit(msg)
 	case warn:
-		l.w.(*syslog.Writer).Warning(msg)
+		s.w.Warning(msg)
 	case info:
-		l.w.(*syslog.Writer).Info(msg)
+		s.w.Info(msg)
 	case debug:
-		l.w.(*syslog.Writer).Debug(msg)
+		s.w.Debug(msg)
 	}
 
 }
@@ -4,7 +4,8 @@ func (l *logger) UseSyslog() error {
 	panic("syslog is not supported under windows")
 }
 
-func (l *logger) writeSyslog(lvl level, format string, v ...interface{}) {
+func NewSyslogSink(min string) (Sink, error) {
+	return nil, ErrOpenSyslog
 }
 
 func UseSyslog() error {